@@ -4,12 +4,15 @@ go 1.20
 
 require (
 	github.com/aws/aws-sdk-go v1.44.321
+	github.com/aws/aws-sdk-go-v2 v1.30.3
 	github.com/pkg/errors v0.9.1
 	github.com/spf13/cobra v1.7.0
-	gopkg.in/ini.v1 v1.67.0
+	golang.org/x/sys v0.20.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
+	github.com/aws/smithy-go v1.20.3 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
@@ -3,9 +3,18 @@ package main
 import (
 	"os"
 
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/awsconfig"
 	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/awsprofile"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/cleanup"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/config"
 	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/env"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/imds"
 	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/process"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/profiles"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/serve"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/token"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/webidentity"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -27,11 +36,16 @@ The following table shows the default values for the call:
 | name                    | default value                   | override                     |
 +-------------------------+---------------------------------+------------------------------+
 | role name               | gitlab-$CI_PROJECT_PATH_SLUG    | --role-name/-r               |
+|                         |                                 | $GITLAB_AWS_ROLE_NAME        |
 | role session name       | <role name>-$CI_PIPELINE_ID     | --role-session-name/-n       |
+|                         |                                 | $GITLAB_AWS_ROLE_SESSION_NAME|
 | aws account id          | $GITLAB_AWS_ACCOUNT_ID          | --aws-account/-A             |
 | duration seconds        | $GITLAB_AWS_DURATION_SECONDS    | --duration-seconds/-d        |
 | web identity token name | GITLAB_AWS_IDENTITY_TOKEN       | --web-identity-token-name/-j |
 
+The defaults for the account, role name, duration, region and token name can be specified in the
+configuration file .gitlab-aws-credential-helper.yaml. Use "config show" to see the effective settings.
+
 The credentials can be returned either as environment variables, stored in a AWS shared credentials file or
 returned as json object suitable for the AWS credential_process interface.
 `,
@@ -39,8 +53,20 @@ returned as json object suitable for the AWS credential_process interface.
 	rootCmd.AddCommand(awsprofile.NewCmd())
 	rootCmd.AddCommand(process.NewCmd())
 	rootCmd.AddCommand(env.NewCmd())
+	rootCmd.AddCommand(profiles.NewCmd())
+	rootCmd.AddCommand(token.NewCmd())
+	rootCmd.AddCommand(awsconfig.NewCmd())
+	rootCmd.AddCommand(webidentity.NewCmd())
+	rootCmd.AddCommand(serve.NewCmd())
+	rootCmd.AddCommand(imds.NewCmd())
+	rootCmd.AddCommand(cleanup.NewCmd())
+	rootCmd.AddCommand(config.NewCmd())
 
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *serve.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode)
+		}
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,182 @@
+package awsconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/profiles"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Cmd to write credential_process profiles to the AWS config file
+type Cmd struct {
+	cobra.Command
+	AWSProfile      string
+	AwsAccount      string
+	RoleName        string
+	RoleArn         string
+	RoleSessionName string
+	DurationSeconds int64
+	ChainRoles      []string
+	Region          string
+	Output          string
+	Filename        string
+	Executable      string
+	DryRun          bool
+}
+
+// NewCmd creates a command to write credential_process profiles to the AWS config file
+func NewCmd() *cobra.Command {
+	c := Cmd{
+		Command: cobra.Command{
+			Use:   "aws-config",
+			Short: "writes profiles using this helper as credential_process to the AWS config file",
+			Long: `
+Writes profiles to the AWS config file, with the credential_process pointing to the absolute path of
+this binary and the arguments to assume the role of the profile. Other sections in the config file are
+preserved. No credentials are obtained by this command: the AWS library calls the credential process
+whenever credentials are required.
+
+Without a profiles configuration file, a single profile is written using the flags. With the option
+--config/-c or the environment variable GITLAB_AWS_PROFILES_FILE, all profiles in the configuration
+file are written, as described by the aws-profiles command.
+
+The following gitlab-ci.yml snippets shows the usage of the aws-config command:
+
+	aws-config-demo:
+	  stage: build
+	  image:
+		name: public.ecr.aws/aws-cli/aws-cli:2.13.17
+		entrypoint: [""]
+	  id_tokens:
+		GITLAB_AWS_IDENTITY_TOKEN:
+		  aud: https://gitlab.com
+	  script:
+		- ./gitlab-aws-credential-helper aws-config
+		- ./gitlab-aws-credential-helper aws-config --name second --role-name SecondDemoRole --region eu-west-1
+		- aws --profile second sts get-caller-identity
+	  needs:
+		- get-credential-helper
+`,
+		},
+	}
+
+	if c.AWSProfile = os.Getenv("GITLAB_AWS_PROFILE"); c.AWSProfile == "" {
+		c.AWSProfile = "default"
+	}
+	c.Filename = os.Getenv("GITLAB_AWS_PROFILES_FILE")
+
+	c.Flags().SortFlags = false
+	c.Flags().StringVarP(&c.AWSProfile, "name", "p", c.AWSProfile, "the name of AWS profile to write")
+	c.Flags().StringVarP(&c.AwsAccount, "aws-account", "A", "", "AWS account id or alias to assume to role in")
+	c.Flags().StringVarP(&c.RoleName, "role-name", "r", "", "Name or template of the role to assume")
+	c.Flags().StringVar(&c.RoleArn, "role-arn", "", "the arn of the role to assume")
+	c.Flags().StringVarP(&c.RoleSessionName, "role-session-name", "n", "", "the role session name or template to use")
+	c.Flags().Int64VarP(&c.DurationSeconds, "duration-seconds", "d", 0, "of the session")
+	c.Flags().StringArrayVarP(&c.ChainRoles, "chain-role", "C", nil, "role to assume next, as <role arn>[,external-id=<id>][,session-name=<name>][,duration-seconds=<seconds>]")
+	c.Flags().StringVar(&c.Region, "region", "", "the region of the profile")
+	c.Flags().StringVarP(&c.Output, "output", "o", "", "the output format of the profile")
+	c.Flags().StringVarP(&c.Filename, "config", "c", c.Filename, "the profiles configuration file (default $GITLAB_AWS_PROFILES_FILE)")
+	c.Flags().StringVar(&c.Executable, "executable", "", "the path of the credential helper (default the absolute path of this binary)")
+	c.Flags().BoolVar(&c.DryRun, "dry-run", false, "show the changes to the config file as a diff, without writing it")
+
+	c.PreRunE = func(_ *cobra.Command, args []string) (err error) {
+		if c.Executable == "" {
+			if c.Executable, err = os.Executable(); err != nil {
+				return errors.Errorf("failed to determine the path of the credential helper, %s", err)
+			}
+		}
+		if c.Executable, err = filepath.Abs(c.Executable); err != nil {
+			return err
+		}
+		if c.Filename == "" && c.AWSProfile == "" {
+			return errors.New("no profile name was specified.")
+		}
+		return nil
+	}
+
+	c.RunE = func(_ *cobra.Command, args []string) error {
+		// account aliases are resolved here, as the credential process may not find the configuration file
+		settings, err := cmd.LoadConfig()
+		if err != nil {
+			return err
+		}
+		if c.Filename == "" {
+			profile := profiles.ProfileConfig{
+				AwsAccount:      c.AwsAccount,
+				RoleName:        c.RoleName,
+				RoleArn:         c.RoleArn,
+				RoleSessionName: c.RoleSessionName,
+				DurationSeconds: c.DurationSeconds,
+				Region:          c.Region,
+				ChainRoles:      c.ChainRoles,
+			}
+			if profile.AwsAccount, err = resolveAccount(profile.AwsAccount, settings.Accounts); err != nil {
+				return err
+			}
+			return WriteToConfig(c.DryRun, c.NewProfile(c.AWSProfile, profile))
+		}
+
+		config, err := profiles.LoadConfig(c.Filename)
+		if err != nil {
+			return err
+		}
+		result := make([]Profile, 0, len(config.Profiles))
+		for _, name := range config.ProfileNames() {
+			profile := config.Profiles[name]
+			if profile.AwsAccount, err = resolveAccount(profile.AwsAccount, settings.Accounts); err != nil {
+				return errors.Errorf("profile %s: %s", name, err)
+			}
+			result = append(result, c.NewProfile(name, profile))
+		}
+		return WriteToConfig(c.DryRun, result...)
+	}
+
+	return &c.Command
+}
+
+// resolveAccount returns the account id of the account alias, or the account id if it is not an alias.
+func resolveAccount(account string, aliases map[string]string) (string, error) {
+	if account == "" {
+		return "", nil
+	}
+	return gitlabcreds.ResolveAccount(account, aliases)
+}
+
+// NewProfile creates the config profile with the credential_process for the profile configuration.
+func (c *Cmd) NewProfile(name string, profile profiles.ProfileConfig) Profile {
+	args := []string{c.Executable, "process"}
+	if profile.RoleArn != "" {
+		args = append(args, "--role-arn", profile.RoleArn)
+	}
+	if profile.AwsAccount != "" {
+		args = append(args, "--aws-account", profile.AwsAccount)
+	}
+	if profile.RoleName != "" {
+		args = append(args, "--role-name", profile.RoleName)
+	}
+	if profile.RoleSessionName != "" {
+		args = append(args, "--role-session-name", profile.RoleSessionName)
+	}
+	if profile.DurationSeconds != 0 {
+		args = append(args, "--duration-seconds", strconv.FormatInt(profile.DurationSeconds, 10))
+	}
+	for _, role := range profile.ChainRoles {
+		args = append(args, "--chain-role", role)
+	}
+
+	values := map[string]string{"credential_process": CommandLine(args)}
+	if region := profile.Region; region != "" {
+		values["region"] = region
+	} else if c.Region != "" {
+		values["region"] = c.Region
+	}
+	if c.Output != "" {
+		values["output"] = c.Output
+	}
+	return Profile{Name: name, Values: values}
+}
@@ -0,0 +1,68 @@
+package awsconfig
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd"
+)
+
+// Profile a profile in the AWS config file.
+type Profile struct {
+	Name   string
+	Values map[string]string
+}
+
+// ConfigFilename returns the name of the AWS config file from AWS_CONFIG_FILE, or ~/.aws/config.
+func ConfigFilename() string {
+	if filename := os.Getenv("AWS_CONFIG_FILE"); filename != "" {
+		return filename
+	}
+	return os.ExpandEnv("$HOME/.aws/config")
+}
+
+// SectionName returns the name of the section of the profile in the AWS config file.
+func SectionName(profileName string) string {
+	if profileName == "default" {
+		return profileName
+	}
+	return "profile " + profileName
+}
+
+// QuoteArgument quotes the command line argument if it contains white space or quotes.
+func QuoteArgument(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// CommandLine returns the command line of the arguments, quoted where required.
+func CommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = QuoteArgument(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// WriteToConfig stores the profiles in the AWS config file, preserving all other sections and keys. The keys
+// are written in alphabetical order. With dryRun, the changes are shown as a diff instead.
+func WriteToConfig(dryRun bool, profiles ...Profile) error {
+	return cmd.UpdateIniFile(ConfigFilename(), dryRun, func(file *cmd.IniFile) error {
+		for _, profile := range profiles {
+			section := SectionName(profile.Name)
+			keys := make([]string, 0, len(profile.Values))
+			for key := range profile.Values {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				file.SetValue(section, key, profile.Values[key])
+			}
+			file.MarkSection(section)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,59 @@
+package awsconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/profiles"
+)
+
+func TestCommandLine(t *testing.T) {
+	got := CommandLine([]string{"/builds/my project/gitlab-aws-credential-helper", "process", "--role-name", `{{env "ROLE"}}`})
+	want := `"/builds/my project/gitlab-aws-credential-helper" process --role-name "{{env \"ROLE\"}}"`
+	if got != want {
+		t.Errorf("CommandLine() = %s, want %s", got, want)
+	}
+}
+
+func TestWriteToConfig(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), ".aws", "config")
+	if err := os.Setenv("AWS_CONFIG_FILE", configFile); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("AWS_CONFIG_FILE")
+	if err := os.MkdirAll(filepath.Dir(configFile), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configFile, []byte("[profile other]\nregion = us-east-1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := Cmd{Executable: "/builds/gitlab-aws-credential-helper", Output: "json"}
+	err := WriteToConfig(
+		false,
+		c.NewProfile("default", profiles.ProfileConfig{}),
+		c.NewProfile("deploy", profiles.ProfileConfig{AwsAccount: "123456789012", RoleName: "deployer", Region: "eu-west-1"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"[profile other]",
+		"[default]",
+		"credential_process = /builds/gitlab-aws-credential-helper process\n",
+		"[profile deploy]",
+		"/builds/gitlab-aws-credential-helper process --aws-account 123456789012 --role-name deployer\n",
+		"eu-west-1",
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("expected %s in config file\n%s", expected, content)
+		}
+	}
+}
@@ -1,22 +1,20 @@
 package awsprofile
 
 import (
-	"log"
 	"os"
-	"path/filepath"
 	"time"
 
 	awssts "github.com/aws/aws-sdk-go/service/sts"
 	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
-	"gopkg.in/ini.v1"
 )
 
 // Cmd to write credentials to the AWS shared credentials file
 type Cmd struct {
 	cmd.RootCommand
 	AWSProfile string
+	DryRun     bool
 }
 
 // NewCmd creates a command to write the AWS shared credentials file
@@ -71,9 +69,10 @@ The following gitlab-ci.yml snippets shows the usage of the aws-profile command:
 		c.AWSProfile = "default"
 	}
 	c.Flags().StringVarP(&c.AWSProfile, "name", "p", c.AWSProfile, "the name of AWS profile to store the credentials in")
+	c.Flags().BoolVar(&c.DryRun, "dry-run", false, "show the changes to the credentials file as a diff, without writing it")
 
 	c.RunE = func(cmd *cobra.Command, args []string) error {
-		return WriteToSharedConfig(c.AWSProfile, c.Credentials)
+		return WriteToSharedConfig(c.DryRun, Profile{Name: c.AWSProfile, Region: c.Region, Credentials: c.Credentials})
 	}
 
 	c.PreRunE = func(cmd *cobra.Command, args []string) error {
@@ -86,57 +85,42 @@ The following gitlab-ci.yml snippets shows the usage of the aws-profile command:
 	return &c.Command
 }
 
-func WriteToSharedConfig(profileName string, credentials *awssts.Credentials) (err error) {
-	var credentialFile string
-	if credentialFile = os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); credentialFile == "" {
-		credentialFile = os.ExpandEnv("$HOME/.aws/credentials")
-	}
-	cfg, err := ini.LooseLoad(credentialFile)
-	if err != nil {
-		return err
-	}
-	var section *ini.Section
-	if cfg.HasSection(profileName) {
-		section = cfg.Section(profileName)
-	} else {
-		if section, err = cfg.NewSection(profileName); err != nil {
-			return err
-		}
-	}
-	values := map[string]string{
-		"aws_access_key_id":     *credentials.AccessKeyId,
-		"aws_secret_access_key": *credentials.SecretAccessKey,
-		"aws_session_token":     *credentials.SessionToken,
-		"expiration":            credentials.Expiration.Format(time.RFC3339),
-	}
-	for key, value := range values {
-		if section.HasKey(key) {
-			section.Key(key).SetValue(value)
-		} else {
-			_, err = section.NewKey(key, value)
-			if err != nil {
-				log.Printf("failed to store new key %s in the config file; %s", key, err)
-			}
-		}
-	}
-	directory := filepath.Dir(credentialFile)
-	if _, err := os.Stat(directory); err != nil && os.IsNotExist(err) {
-		err = os.MkdirAll(directory, 0o750)
-		if err != nil {
-			return err
-		}
-	}
+// Profile is a named set of credentials to store in the AWS shared credentials file.
+type Profile struct {
+	Name        string
+	Region      string
+	Credentials *awssts.Credentials
+}
 
-	var file *os.File
-	if file, err = os.OpenFile(credentialFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o700); err != nil {
-		return err
+// SharedCredentialsFilename returns the name of the AWS shared credentials file from AWS_SHARED_CREDENTIALS_FILE,
+// or ~/.aws/credentials.
+func SharedCredentialsFilename() string {
+	if filename := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); filename != "" {
+		return filename
 	}
-	defer func(file *os.File) {
-		if err := file.Close(); err != nil {
-			log.Printf("WARNING: failed to close %s", credentialFile)
+	return os.ExpandEnv("$HOME/.aws/credentials")
+}
+
+// WriteToSharedConfig stores the profiles in the AWS shared credentials file in a single, atomic update. With
+// dryRun, the changes are shown as a diff instead.
+func WriteToSharedConfig(dryRun bool, profiles ...Profile) error {
+	return cmd.UpdateIniFile(SharedCredentialsFilename(), dryRun, func(file *cmd.IniFile) error {
+		for _, profile := range profiles {
+			updateProfile(file, profile)
 		}
-	}(file)
+		return nil
+	})
+}
 
-	_, err = cfg.WriteTo(file)
-	return err
+// updateProfile sets the keys of the profile in a fixed order, leaving all other keys untouched.
+func updateProfile(file *cmd.IniFile, profile Profile) {
+	credentials := profile.Credentials
+	file.SetValue(profile.Name, "aws_access_key_id", *credentials.AccessKeyId)
+	file.SetValue(profile.Name, "aws_secret_access_key", *credentials.SecretAccessKey)
+	file.SetValue(profile.Name, "aws_session_token", *credentials.SessionToken)
+	file.SetValue(profile.Name, "expiration", credentials.Expiration.Format(time.RFC3339))
+	if profile.Region != "" {
+		file.SetValue(profile.Name, "region", profile.Region)
+	}
+	file.MarkSection(profile.Name)
 }
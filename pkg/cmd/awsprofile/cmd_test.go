@@ -0,0 +1,77 @@
+package awsprofile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds/ststest"
+)
+
+const manualProfile = "# hand-written\n[manual]\naws_access_key_id = AKIA\naws_secret_access_key = secret\n"
+
+func setup(t *testing.T) (*ststest.Server, string) {
+	server := ststest.NewServer()
+	t.Cleanup(server.Close)
+	server.Setenv(t, "arn:aws:iam::123456789012:role/gitlab-deployer")
+	t.Setenv("GITLAB_AWS_PROFILE", "")
+	filename := filepath.Join(t.TempDir(), "credentials")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filename)
+	if err := os.WriteFile(filename, []byte(manualProfile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return server, filename
+}
+
+func runAWSProfile(args ...string) error {
+	command := NewCmd()
+	command.SetArgs(args)
+	command.SilenceUsage, command.SilenceErrors = true, true
+	return command.Execute()
+}
+
+func TestAWSProfileCommand(t *testing.T) {
+	server, filename := setup(t)
+	if err := runAWSProfile("--name", "deploy", "--region", "eu-west-1"); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), manualProfile+"\n# written by gitlab-aws-credential-helper\n[deploy]\n") {
+		t.Errorf("expected the profile to be appended after the hand-written profile, got\n%s", content)
+	}
+	for _, want := range []string{"aws_access_key_id = ASIAFAKE000000000001\n", "aws_session_token = token-1\n", "region = eu-west-1\n", "expiration = "} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected %s in the credentials file, got\n%s", want, content)
+		}
+	}
+
+	if err = runAWSProfile("--name", "deploy"); err != nil {
+		t.Fatal(err)
+	}
+	if content, err = os.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(content), "[deploy]") != 1 || !strings.Contains(string(content), "aws_access_key_id = ASIAFAKE000000000002\n") {
+		t.Errorf("expected the profile to be updated in place, got\n%s", content)
+	}
+	if n := len(server.Requests()); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestAWSProfileCommandError(t *testing.T) {
+	server, filename := setup(t)
+	server.Enqueue(ststest.Response{ErrorCode: "InvalidIdentityToken", ErrorMessage: "Couldn't retrieve verification key from your identity provider"})
+
+	err := runAWSProfile("--name", "deploy")
+	if err == nil || !strings.Contains(err.Error(), "InvalidIdentityToken") {
+		t.Errorf("expected an InvalidIdentityToken error, got %v", err)
+	}
+	if content, _ := os.ReadFile(filename); string(content) != manualProfile {
+		t.Errorf("expected the credentials file to be unchanged, got\n%s", content)
+	}
+}
@@ -0,0 +1,180 @@
+package cleanup
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/awsconfig"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/awsprofile"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/process"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/webidentity"
+	"github.com/spf13/cobra"
+)
+
+// Cmd to remove the profiles written by the credential helper.
+type Cmd struct {
+	cobra.Command
+	Names   []string
+	All     bool
+	Expired bool
+	DryRun  bool
+}
+
+// NewCmd creates a command to remove the profiles written by the credential helper.
+func NewCmd() *cobra.Command {
+	c := Cmd{
+		Command: cobra.Command{
+			Use:   "cleanup [profile...]",
+			Short: "removes the profiles written by the credential helper",
+			Long: `
+Removes the named profiles written by the credential helper from the AWS shared credentials file and the
+AWS config file. Without profile names, the profile defaults to $GITLAB_AWS_PROFILE or "default". Profiles
+which were not written by the credential helper are never removed, except with --expired.
+
+With --all, all profiles written by the credential helper are removed, together with the cached credentials
+of the process command and the id token file of the web-identity command. With --expired, all profiles in
+the AWS shared credentials file with an expiration in the past are removed.
+
+On shell runners which are reused across jobs, call the cleanup command in the after_script, so that
+no credentials are left on disk:
+
+	aws-profile-demo:
+	  stage: build
+	  id_tokens:
+		GITLAB_AWS_IDENTITY_TOKEN:
+		  aud: https://gitlab.com
+	  script:
+		- ./gitlab-aws-credential-helper aws-profile
+		- aws sts get-caller-identity
+	  after_script:
+		- ./gitlab-aws-credential-helper cleanup --all
+`,
+		},
+	}
+
+	c.Flags().SortFlags = false
+	c.Flags().BoolVarP(&c.All, "all", "a", false, "remove all profiles written by the credential helper, and the cached credentials")
+	c.Flags().BoolVar(&c.Expired, "expired", false, "remove all profiles with an expiration in the past")
+	c.Flags().BoolVar(&c.DryRun, "dry-run", false, "show the changes to the credentials and config file as a diff, without writing them")
+
+	c.RunE = func(_ *cobra.Command, args []string) error {
+		c.Names = args
+		if len(c.Names) == 0 && !c.All && !c.Expired {
+			if profile := os.Getenv("GITLAB_AWS_PROFILE"); profile != "" {
+				c.Names = []string{profile}
+			} else {
+				c.Names = []string{"default"}
+			}
+		}
+		return c.Cleanup(time.Now())
+	}
+
+	return &c.Command
+}
+
+// IsExpired returns true if the section has an expiration key with a time before now.
+func IsExpired(file *cmd.IniFile, section string, now time.Time) bool {
+	value, found := file.Value(section, "expiration")
+	if !found {
+		return false
+	}
+	expiration, err := time.Parse(time.RFC3339, value)
+	return err == nil && expiration.Before(now)
+}
+
+func (c *Cmd) isNamed(name string) bool {
+	for _, n := range c.Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// selected returns true if the profile in the section is to be removed.
+func (c *Cmd) selected(file *cmd.IniFile, name, section string, now time.Time) bool {
+	if c.Expired && IsExpired(file, section, now) {
+		return true
+	}
+	return file.IsMarkedSection(section) && (c.All || c.isNamed(name))
+}
+
+// RemoveProfiles removes the sections for which remove returns true from the ini file, and returns the removed sections.
+func RemoveProfiles(filename string, dryRun bool, remove func(file *cmd.IniFile, section string) bool) (removed []string, err error) {
+	if _, err = os.Stat(filename); os.IsNotExist(err) {
+		return nil, nil
+	}
+	err = cmd.UpdateIniFile(filename, dryRun, func(file *cmd.IniFile) error {
+		for _, section := range file.Sections() {
+			if remove(file, section) {
+				removed = append(removed, section)
+			}
+		}
+		for _, section := range removed {
+			file.DeleteSection(section)
+		}
+		return nil
+	})
+	return removed, err
+}
+
+func (c *Cmd) removeFile(filename string) {
+	if c.DryRun {
+		if _, err := os.Stat(filename); err == nil {
+			log.Printf("would remove %s", filename)
+		}
+	} else if err := os.Remove(filename); err == nil {
+		log.Printf("removed %s", filename)
+	} else if !os.IsNotExist(err) {
+		log.Printf("WARNING: failed to remove %s, %s", filename, err)
+	}
+}
+
+// Cleanup removes the selected profiles from the AWS shared credentials and config file, and with --all
+// the cached credentials and the id token file.
+func (c *Cmd) Cleanup(now time.Time) error {
+	credentialsFile := awsprofile.SharedCredentialsFilename()
+	_, err := RemoveProfiles(credentialsFile, c.DryRun, func(file *cmd.IniFile, section string) bool {
+		if c.selected(file, section, section, now) {
+			return true
+		}
+		if c.isNamed(section) {
+			log.Printf("WARNING: profile %s was not written by the credential helper, not removed", section)
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+
+	var tokenFiles []string
+	_, err = RemoveProfiles(awsconfig.ConfigFilename(), c.DryRun, func(file *cmd.IniFile, section string) bool {
+		if !c.selected(file, strings.TrimPrefix(section, "profile "), section, now) {
+			return false
+		}
+		if tokenFile, found := file.Value(section, "web_identity_token_file"); found {
+			tokenFiles = append(tokenFiles, tokenFile)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, tokenFile := range tokenFiles {
+		c.removeFile(tokenFile)
+	}
+
+	if c.All && !c.DryRun {
+		cache := process.CredentialCache{Directory: process.DefaultCacheDirectory()}
+		if err = cache.Clear(); err != nil {
+			return err
+		}
+	}
+	if c.All {
+		c.removeFile(webidentity.DefaultTokenFile())
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package cleanup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awssts "github.com/aws/aws-sdk-go/service/sts"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/awsconfig"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/awsprofile"
+)
+
+func setup(t *testing.T) (credentialsFile, configFile string) {
+	directory := t.TempDir()
+	credentialsFile = filepath.Join(directory, "credentials")
+	configFile = filepath.Join(directory, "config")
+	for name, value := range map[string]string{
+		"AWS_SHARED_CREDENTIALS_FILE":        credentialsFile,
+		"AWS_CONFIG_FILE":                    configFile,
+		"GITLAB_AWS_CACHE_DIR":               filepath.Join(directory, "cache"),
+		"GITLAB_AWS_WEB_IDENTITY_TOKEN_FILE": filepath.Join(directory, "token"),
+	} {
+		t.Setenv(name, value)
+	}
+
+	err := os.WriteFile(credentialsFile, []byte(`# hand-written
+[manual]
+aws_access_key_id = AKIA
+aws_secret_access_key = secret
+
+[stale]
+aws_access_key_id = ASIA
+expiration = 2020-01-01T00:00:00Z
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials := func(expiration time.Time) *awssts.Credentials {
+		return &awssts.Credentials{
+			AccessKeyId:     aws.String("key"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(expiration),
+		}
+	}
+	err = awsprofile.WriteToSharedConfig(
+		false,
+		awsprofile.Profile{Name: "default", Credentials: credentials(time.Now().Add(time.Hour))},
+		awsprofile.Profile{Name: "deploy", Credentials: credentials(time.Now().Add(-time.Hour))},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(configFile, []byte("[profile manual]\nregion = eu-west-1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tokenFile := filepath.Join(directory, "token")
+	if err = os.WriteFile(tokenFile, []byte("token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err = awsconfig.WriteToConfig(false, awsconfig.Profile{
+		Name:   "web",
+		Values: map[string]string{"web_identity_token_file": tokenFile},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return credentialsFile, configFile
+}
+
+func sections(t *testing.T, filename string) string {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "[") {
+			result = append(result, line)
+		}
+	}
+	return strings.Join(result, " ")
+}
+
+func TestCleanup(t *testing.T) {
+	tests := []struct {
+		name        string
+		cmd         Cmd
+		credentials string
+		config      string
+		tokenFile   bool
+	}{
+		{
+			name:        "named",
+			cmd:         Cmd{Names: []string{"default", "manual"}},
+			credentials: "[manual] [stale] [deploy]",
+			config:      "[profile manual] [profile web]",
+			tokenFile:   true,
+		},
+		{
+			name:        "all",
+			cmd:         Cmd{All: true},
+			credentials: "[manual] [stale]",
+			config:      "[profile manual]",
+		},
+		{
+			name:        "expired",
+			cmd:         Cmd{Expired: true},
+			credentials: "[manual] [default]",
+			config:      "[profile manual] [profile web]",
+			tokenFile:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			credentialsFile, configFile := setup(t)
+			if err := tt.cmd.Cleanup(time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if got := sections(t, credentialsFile); got != tt.credentials {
+				t.Errorf("credentials file has sections %s, want %s", got, tt.credentials)
+			}
+			if got := sections(t, configFile); got != tt.config {
+				t.Errorf("config file has sections %s, want %s", got, tt.config)
+			}
+			if _, err := os.Stat(os.Getenv("GITLAB_AWS_WEB_IDENTITY_TOKEN_FILE")); os.IsNotExist(err) == tt.tokenFile {
+				t.Errorf("expected token file to exist %v", tt.tokenFile)
+			}
+		})
+	}
+}
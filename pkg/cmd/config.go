@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFilename the name of the configuration file in the repository.
+const ConfigFilename = ".gitlab-aws-credential-helper.yaml"
+
+// SystemConfigFile the system wide configuration file.
+var SystemConfigFile = "/etc/gitlab-aws-credential-helper/config.yaml"
+
+// UserConfigFile overrides the configuration file of the user, which defaults to config.yaml in the
+// gitlab-aws-credential-helper directory of the user configuration directory.
+var UserConfigFile string
+
+// Config the settings read from the configuration files, supplying the defaults for the flags and
+// environment variables.
+type Config struct {
+	AwsAccount           string `yaml:"aws-account"`
+	RoleName             string `yaml:"role-name"`
+	DurationSeconds      int64  `yaml:"duration-seconds"`
+	Region               string `yaml:"region"`
+	WebIdentityTokenName string `yaml:"web-identity-token-name"`
+	Rules                []Rule `yaml:"rules"`
+	// Accounts the AWS account ids by alias, accepted wherever an account is.
+	Accounts map[string]string `yaml:"accounts"`
+
+	// Sources the configuration file each setting was read from, by name.
+	Sources map[string]string `yaml:"-"`
+}
+
+// ConfigFile a configuration file and the layer it belongs to.
+type ConfigFile struct {
+	Layer    string
+	Filename string
+}
+
+// ConfigFiles returns the configuration files in order of increasing precedence: the system file, the user
+// file and the file in the repository, in $CI_PROJECT_DIR or the working directory.
+func ConfigFiles() []ConfigFile {
+	result := []ConfigFile{{Layer: "system", Filename: SystemConfigFile}}
+	if UserConfigFile != "" {
+		result = append(result, ConfigFile{Layer: "user", Filename: UserConfigFile})
+	} else if configDir, err := os.UserConfigDir(); err == nil {
+		result = append(result, ConfigFile{Layer: "user", Filename: filepath.Join(configDir, "gitlab-aws-credential-helper", "config.yaml")})
+	}
+	repoFile := filepath.Join(os.Getenv("CI_PROJECT_DIR"), ConfigFilename)
+	if absolute, err := filepath.Abs(repoFile); err == nil {
+		repoFile = absolute
+	}
+	return append(result, ConfigFile{Layer: "repo", Filename: repoFile})
+}
+
+// LoadConfig reads the configuration files, where the settings of a file override those of the files
+// before it. Missing files are skipped. On an invalid file, returns the settings read so far and err set.
+func LoadConfig() (*Config, error) {
+	config := &Config{Sources: map[string]string{}}
+	for _, file := range ConfigFiles() {
+		content, err := os.ReadFile(file.Filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return config, errors.Errorf("failed to read configuration file %s, %s", file.Filename, err)
+		}
+		var layer Config
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(&layer); err != nil && err != io.EOF {
+			return config, errors.Errorf("failed to parse configuration file %s, %s", file.Filename, err)
+		}
+		if layer.DurationSeconds < 0 {
+			return config, errors.Errorf("duration-seconds in %s is not a positive integer", file.Filename)
+		}
+		for alias, accountId := range layer.Accounts {
+			if !gitlabcreds.IsAccountAlias(alias) {
+				return config, errors.Errorf("the account alias %s in %s is a number", alias, file.Filename)
+			}
+			if err = gitlabcreds.ValidateAccountId(accountId); err != nil {
+				return config, errors.Errorf("invalid account id for alias %s in %s, %s", alias, file.Filename, err)
+			}
+		}
+		for i := range layer.Rules {
+			if err = layer.Rules[i].Validate(); err != nil {
+				return config, errors.Errorf("rule %d in %s is invalid, %s", i+1, file.Filename, err)
+			}
+		}
+		config.merge(&layer, file.Layer+" file "+file.Filename)
+	}
+	return config, config.validateAccounts()
+}
+
+// validateAccounts returns an error if the account or the account of a rule is not an account id or alias.
+func (c *Config) validateAccounts() error {
+	if c.AwsAccount != "" {
+		if _, err := gitlabcreds.ResolveAccount(c.AwsAccount, c.Accounts); err != nil {
+			return errors.Errorf("invalid aws-account in %s, %s", c.Sources["aws-account"], err)
+		}
+	}
+	for i, rule := range c.Rules {
+		if rule.AwsAccount == "" {
+			continue
+		}
+		if _, err := gitlabcreds.ResolveAccount(rule.AwsAccount, c.Accounts); err != nil {
+			return errors.Errorf("invalid aws-account in rule %d in %s, %s", i+1, c.Sources["rules"], err)
+		}
+	}
+	return nil
+}
+
+// merge overrides the settings with those set in the layer. The rules of the layer replace all rules, the
+// account aliases of the layer are added to those before it.
+func (c *Config) merge(layer *Config, source string) {
+	set := func(name string, value *string, layerValue string) {
+		if layerValue != "" {
+			*value = layerValue
+			c.Sources[name] = source
+		}
+	}
+	set("aws-account", &c.AwsAccount, layer.AwsAccount)
+	set("role-name", &c.RoleName, layer.RoleName)
+	set("region", &c.Region, layer.Region)
+	set("web-identity-token-name", &c.WebIdentityTokenName, layer.WebIdentityTokenName)
+	if layer.DurationSeconds != 0 {
+		c.DurationSeconds = layer.DurationSeconds
+		c.Sources["duration-seconds"] = source
+	}
+	for alias, accountId := range layer.Accounts {
+		if c.Accounts == nil {
+			c.Accounts = map[string]string{}
+		}
+		c.Accounts[alias] = accountId
+	}
+	if len(layer.Rules) > 0 {
+		c.Rules = layer.Rules
+		c.Sources["rules"] = source
+	}
+}
@@ -0,0 +1,15 @@
+package config
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// NewCmd creates a command to group the configuration subcommands
+func NewCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "config",
+		Short: "commands to examine the configuration",
+	}
+	c.AddCommand(NewShowCmd())
+	return c
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd"
+	"github.com/spf13/cobra"
+)
+
+// ShowCmd to print the effective settings and where they came from
+type ShowCmd struct {
+	cmd.RootCommand
+}
+
+// NewShowCmd creates a command to print the effective settings and where they came from
+func NewShowCmd() *cobra.Command {
+	c := ShowCmd{
+		RootCommand: cmd.RootCommand{
+			Command: cobra.Command{
+				Use:   "show",
+				Short: "prints the effective value of each setting and where it came from",
+				Long: `
+Prints the effective value of each setting which can be specified in a configuration file, and where
+it came from. A setting is taken from the first of: the flag, the environment variable, the
+configuration file in the repository, the user configuration file, the system configuration file
+or the built-in default. The global flags are accepted, so that you can check their effect.
+`,
+			},
+		},
+	}
+
+	c.AddPersistentFlags()
+	c.PersistentPreRunE = func(_ *cobra.Command, args []string) error {
+		return c.ValidateEnvironment()
+	}
+
+	c.RunE = func(_ *cobra.Command, args []string) error {
+		return WriteSettings(os.Stdout, c.Settings(), cmd.ConfigFiles())
+	}
+
+	return &c.Command
+}
+
+// WriteSettings writes the settings as a table, followed by the configuration files searched.
+func WriteSettings(w io.Writer, settings []cmd.Setting, files []cmd.ConfigFile) error {
+	writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if _, err := fmt.Fprintln(writer, "SETTING\tVALUE\tSOURCE"); err != nil {
+		return err
+	}
+	for _, setting := range settings {
+		if _, err := fmt.Fprintf(writer, "%s\t%s\t%s\n", setting.Name, setting.Value, setting.Source); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(w, "\nconfiguration files, in order of increasing precedence:"); err != nil {
+		return err
+	}
+	for _, file := range files {
+		status := "not found"
+		if _, err := os.Stat(file.Filename); err == nil {
+			status = "loaded"
+		}
+		if _, err := fmt.Fprintf(w, "  %-6s %s (%s)\n", file.Layer, file.Filename, status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
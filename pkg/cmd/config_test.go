@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupConfigFiles writes the system, user and repository configuration files, skipping empty content.
+func setupConfigFiles(t *testing.T, system, user, repo string) {
+	directory := t.TempDir()
+	t.Setenv("CI_PROJECT_DIR", filepath.Join(directory, "repo"))
+	for _, name := range []string{"XDG_CONFIG_HOME", "HOME", "AppData"} {
+		t.Setenv(name, filepath.Join(directory, "home"))
+	}
+	systemConfigFile, userConfigFile := SystemConfigFile, UserConfigFile
+	SystemConfigFile = filepath.Join(directory, "system", "config.yaml")
+	UserConfigFile = filepath.Join(directory, "user", "config.yaml")
+	t.Cleanup(func() { SystemConfigFile, UserConfigFile = systemConfigFile, userConfigFile })
+
+	files := ConfigFiles()
+	for i, content := range []string{system, user, repo} {
+		if content == "" {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(files[i].Filename), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(files[i].Filename, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"GITLAB_AWS_ACCOUNT_ID", "GITLAB_AWS_ROLE_NAME", "GITLAB_AWS_DURATION_SECONDS", "GITLAB_AWS_REGION", "GITLAB_AWS_IDENTITY_TOKEN_NAME", "GITLAB_AWS_ROLE_ARN", "CI_PROJECT_PATH_SLUG"} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	setupConfigFiles(t,
+		"aws-account: \"111111111111\"\nregion: us-east-1\nduration-seconds: 900\naccounts:\n  prod: \"333333333333\"\n  staging: \"444444444444\"\n",
+		"aws-account: \"222222222222\"\naccounts:\n  prod: \"555555555555\"\n",
+		"role-name: \"gitlab-{{ .ProjectPathSlug }}\"\nregion: eu-west-1\n",
+	)
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.AwsAccount != "222222222222" || config.Region != "eu-west-1" || config.DurationSeconds != 900 || config.RoleName != "gitlab-{{ .ProjectPathSlug }}" {
+		t.Errorf("unexpected configuration %+v", config)
+	}
+	if len(config.Accounts) != 2 || config.Accounts["prod"] != "555555555555" || config.Accounts["staging"] != "444444444444" {
+		t.Errorf("expected the account aliases of all files, got %v", config.Accounts)
+	}
+	for name, layer := range map[string]string{"aws-account": "user", "region": "repo", "duration-seconds": "system", "role-name": "repo"} {
+		if !strings.HasPrefix(config.Sources[name], layer+" file ") {
+			t.Errorf("expected %s from the %s file, got %s", name, layer, config.Sources[name])
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unknown setting", "aws-acount: \"123456789012\"\n", "field aws-acount not found"},
+		{"invalid duration", "duration-seconds: -1\n", "is not a positive integer"},
+		{"invalid yaml", "region: [", "failed to parse configuration file"},
+		{"numeric alias", "accounts:\n  \"123\": \"123456789012\"\n", "the account alias 123 in"},
+		{"invalid alias account id", "accounts:\n  prod: \"12345678901\"\n", "invalid account id for alias prod"},
+		{"unknown account alias", "accounts:\n  prod: \"123456789012\"\naws-account: prdo\n", "one of the account aliases prod"},
+		{"invalid account id", "aws-account: \"12345678901\"\n", "is not a 12 digit number"},
+		{"unknown rule account alias", "rules:\n  - aws-account: staging\n    role-name: reader\n", "invalid aws-account in rule 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupConfigFiles(t, "", "", tt.content)
+			if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error %s, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	setupConfigFiles(t, "", "", "")
+	if config, err := LoadConfig(); err != nil || len(config.Sources) != 0 {
+		t.Errorf("expected no settings without configuration files, got %+v, %v", config, err)
+	}
+}
+
+func TestSettingsPrecedence(t *testing.T) {
+	setupConfigFiles(t,
+		"web-identity-token-name: SYSTEM_TOKEN\naccounts:\n  prod: \"123456789012\"\n",
+		"region: eu-central-1\nduration-seconds: 900\n",
+		"aws-account: prod\nregion: eu-west-1\nrole-name: deployer\n",
+	)
+	t.Setenv("GITLAB_AWS_DURATION_SECONDS", "1800")
+
+	c := &RootCommand{}
+	c.AddPersistentFlags()
+	if err := c.Flags().Set("role-name", "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]Setting{
+		"aws-account":             {Value: "123456789012 (prod)", Source: "repo file"},
+		"role-name":               {Value: "admin", Source: "flag --role-name"},
+		"duration-seconds":        {Value: "1800", Source: "env $GITLAB_AWS_DURATION_SECONDS"},
+		"region":                  {Value: "eu-west-1", Source: "repo file"},
+		"web-identity-token-name": {Value: "SYSTEM_TOKEN", Source: "system file"},
+	}
+	settings := c.Settings()
+	if len(settings) != len(want) {
+		t.Fatalf("expected %d settings, got %d", len(want), len(settings))
+	}
+	for _, setting := range settings {
+		expected := want[setting.Name]
+		if setting.Value != expected.Value || !strings.HasPrefix(setting.Source, expected.Source) {
+			t.Errorf("setting %s = %s from %s, want %s from %s", setting.Name, setting.Value, setting.Source, expected.Value, expected.Source)
+		}
+	}
+}
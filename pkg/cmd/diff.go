@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffContext the number of unchanged lines shown around a change.
+const DiffContext = 3
+
+type diffLine struct {
+	kind byte
+	text string
+}
+
+func splitLines(content []byte) []string {
+	text := strings.TrimSuffix(string(content), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// diffLines returns the edit script from a to b, based on the longest common subsequence of lines.
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	result := make([]diffLine, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			result = append(result, diffLine{' ', a[i]})
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			result = append(result, diffLine{'-', a[i]})
+			i++
+		default:
+			result = append(result, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return result
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// Diff returns the changes from before to after as a unified diff of the file, or an empty string if
+// there are no changes.
+func Diff(filename string, before, after []byte) string {
+	lines := diffLines(splitLines(before), splitLines(after))
+
+	var result strings.Builder
+	for start := 0; start < len(lines); {
+		if lines[start].kind == ' ' {
+			start++
+			continue
+		}
+
+		// extend the hunk until the changes are more than twice the context apart
+		end := start
+		for i := start; i < len(lines) && i-end <= 2*DiffContext; i++ {
+			if lines[i].kind != ' ' {
+				end = i + 1
+			}
+		}
+		first, last := start-DiffContext, end+DiffContext
+		if first < 0 {
+			first = 0
+		}
+		if last > len(lines) {
+			last = len(lines)
+		}
+
+		oldStart, newStart := 0, 0
+		for _, line := range lines[:first] {
+			if line.kind != '+' {
+				oldStart++
+			}
+			if line.kind != '-' {
+				newStart++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, line := range lines[first:last] {
+			if line.kind != '+' {
+				oldCount++
+			}
+			if line.kind != '-' {
+				newCount++
+			}
+		}
+
+		if result.Len() == 0 {
+			fmt.Fprintf(&result, "--- %s\n+++ %s\n", filename, filename)
+		}
+		fmt.Fprintf(&result, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, line := range lines[first:last] {
+			fmt.Fprintf(&result, "%c%s\n", line.kind, line.text)
+		}
+		start = last
+	}
+	return result.String()
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	lines := func(lines ...string) []byte {
+		return []byte(strings.Join(lines, "\n") + "\n")
+	}
+	tests := []struct {
+		name          string
+		before, after []byte
+		want          string
+	}{
+		{
+			name:   "no changes",
+			before: lines("a", "b"),
+			after:  lines("a", "b"),
+			want:   "",
+		},
+		{
+			name:   "new file",
+			before: nil,
+			after:  lines("[default]", "region = eu-west-1"),
+			want:   "--- credentials\n+++ credentials\n@@ -0,0 +1,2 @@\n+[default]\n+region = eu-west-1\n",
+		},
+		{
+			name:   "changed line with context",
+			before: lines("1", "2", "3", "4", "5", "6", "7", "8", "9"),
+			after:  lines("1", "2", "3", "4", "x", "6", "7", "8", "9"),
+			want:   "--- credentials\n+++ credentials\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+x\n 6\n 7\n 8\n",
+		},
+		{
+			name:   "separate hunks",
+			before: lines("1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"),
+			after:  lines("x", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"),
+			want:   "--- credentials\n+++ credentials\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -9,4 +9,3 @@\n 9\n 10\n 11\n-12\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff("credentials", tt.before, tt.after); got != tt.want {
+				t.Errorf("Diff() = \n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,13 +1,13 @@
 package env
 
 import (
-	"errors"
-	"fmt"
 	"log"
 	"os"
+	"time"
 
 	awssts "github.com/aws/aws-sdk-go/service/sts"
 	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -15,7 +15,7 @@ import (
 type Cmd struct {
 	cmd.RootCommand
 	Filename string
-	Export   bool
+	Format   Format
 }
 
 // NewCmd creates a command to write the credentials to a env file.
@@ -26,9 +26,10 @@ func NewCmd() *cobra.Command {
 				Use:   "env",
 				Short: "returns the credentials as environment variables",
 				Long: `
-Returns the credentials as the environment variables AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
-and AWS_SESSION_TOKEN. When you pass a command to execute on the command line, the command
-will be executed without writing the credentials.
+Returns the credentials as the environment variables AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+AWS_SESSION_TOKEN and AWS_CREDENTIAL_EXPIRATION. When a region is specified with --region, the
+variables AWS_REGION and AWS_DEFAULT_REGION are returned too. When you pass a command to execute on
+the command line, the command will be executed without writing the credentials.
 
 The following gitlab-ci.yml snippets shows the usage of the env command:
 
@@ -69,27 +70,70 @@ The following gitlab-ci.yml snippets shows the usage of the env command:
 
 	c.AddPersistentFlags()
 	c.Flags().StringVarP(&c.Filename, "filename", "f", "", "the name of the env file")
-	c.Flags().BoolVarP(&c.Export, "export", "e", false, "prefix variables with export keyword")
+	c.Format.AddFlags(&c.Command)
 
 	c.PreRunE = func(cmd *cobra.Command, args []string) error {
 		if c.Filename != "" && len(args) > 0 {
 			return errors.New("either specify an output file or a command to execute")
 		}
-		return nil
+		return c.Format.Validate()
 	}
 
 	c.RunE = func(cmd *cobra.Command, args []string) error {
 		if len(args) > 0 {
-			return ExecProcess(args, c.Credentials)
+			return ExecProcess(args, c.Credentials, c.Region)
 		} else {
-			return WriteDotEnv(c.Filename, c.Export, c.Credentials)
+			return WriteDotEnv(c.Filename, c.Format, c.Credentials, c.Region)
 		}
 	}
 
 	return &c.Command
 }
 
-func WriteDotEnv(filename string, export bool, credentials *awssts.Credentials) error {
+// Variable an environment variable.
+type Variable struct {
+	Name  string
+	Value string
+}
+
+// CredentialVariables returns the environment variables AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN
+// and AWS_CREDENTIAL_EXPIRATION, followed by AWS_REGION and AWS_DEFAULT_REGION if a region is specified.
+func CredentialVariables(credentials *awssts.Credentials, region string) []Variable {
+	value := func(v *string) string {
+		if v == nil {
+			return ""
+		}
+		return *v
+	}
+	result := []Variable{
+		{"AWS_ACCESS_KEY_ID", value(credentials.AccessKeyId)},
+		{"AWS_SECRET_ACCESS_KEY", value(credentials.SecretAccessKey)},
+		{"AWS_SESSION_TOKEN", value(credentials.SessionToken)},
+	}
+	if credentials.Expiration != nil {
+		result = append(result, Variable{"AWS_CREDENTIAL_EXPIRATION", credentials.Expiration.UTC().Format(time.RFC3339)})
+	}
+	return append(result, RegionVariables(region)...)
+}
+
+// RegionVariables returns the environment variables AWS_REGION and AWS_DEFAULT_REGION, or none if the region is empty.
+func RegionVariables(region string) []Variable {
+	if region == "" {
+		return nil
+	}
+	return []Variable{
+		{"AWS_REGION", region},
+		{"AWS_DEFAULT_REGION", region},
+	}
+}
+
+// WriteDotEnv writes the credentials as environment variables to the file, or stdout if no filename is specified.
+func WriteDotEnv(filename string, format Format, credentials *awssts.Credentials, region string) error {
+	return WriteVariables(filename, format, CredentialVariables(credentials, region))
+}
+
+// WriteVariables writes the environment variables in the format to the file, or stdout if no filename is specified.
+func WriteVariables(filename string, format Format, variables []Variable) error {
 	var err error
 
 	file := os.Stdout
@@ -106,24 +150,5 @@ func WriteDotEnv(filename string, export bool, credentials *awssts.Credentials)
 		}()
 	}
 
-	writeEnvVar := func(key string, value *string) {
-		var empty, prefix string
-		if value == nil {
-			value = &empty
-		}
-		if export {
-			prefix = "export "
-		}
-		line := fmt.Sprintf("%s%s=%s\n", prefix, key, *value)
-		_, err = file.WriteString(line)
-		if err != nil {
-			log.Fatalf("error writing environment variable value to file, %s", err)
-		}
-	}
-
-	writeEnvVar("AWS_ACCESS_KEY_ID", credentials.AccessKeyId)
-	writeEnvVar("AWS_SECRET_ACCESS_KEY", credentials.SecretAccessKey)
-	writeEnvVar("AWS_SESSION_TOKEN", credentials.SessionToken)
-
-	return nil
+	return format.Write(file, variables)
 }
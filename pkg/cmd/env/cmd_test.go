@@ -0,0 +1,64 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds/ststest"
+)
+
+func runEnv(args ...string) error {
+	command := NewCmd()
+	command.SetArgs(args)
+	command.SilenceUsage, command.SilenceErrors = true, true
+	return command.Execute()
+}
+
+func TestEnvCommand(t *testing.T) {
+	server := ststest.NewServer()
+	defer server.Close()
+	server.Setenv(t, "arn:aws:iam::123456789012:role/gitlab-deployer")
+	filename := filepath.Join(t.TempDir(), "aws.env")
+
+	if err := runEnv("--filename", filename, "--region", "eu-west-1", "--duration-seconds", "900"); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"AWS_ACCESS_KEY_ID=ASIAFAKE000000000001\n",
+		"AWS_SECRET_ACCESS_KEY=secret-1\n",
+		"AWS_SESSION_TOKEN=token-1\n",
+		"AWS_CREDENTIAL_EXPIRATION=",
+		"AWS_REGION=eu-west-1\n",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected %s in the env file, got\n%s", want, content)
+		}
+	}
+	requests := server.Requests()
+	if len(requests) != 1 || requests[0].DurationSeconds != 900 || requests[0].RoleSessionName != "gitlab-deployer-1234" {
+		t.Errorf("unexpected requests %+v", requests)
+	}
+}
+
+func TestEnvCommandError(t *testing.T) {
+	server := ststest.NewServer()
+	defer server.Close()
+	server.Setenv(t, "arn:aws:iam::123456789012:role/gitlab-deployer")
+	t.Setenv("GITLAB_AWS_MAX_ATTEMPTS", "2")
+	server.Default = ststest.Response{ErrorCode: "IDPCommunicationError", StatusCode: 400}
+	filename := filepath.Join(t.TempDir(), "aws.env")
+
+	err := runEnv("--filename", filename, "--retry-deadline", "1m")
+	if err == nil || !strings.Contains(err.Error(), "failed after 2 attempts") {
+		t.Errorf("expected the transient error to be retried, got %v", err)
+	}
+	if _, err = os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("expected no env file on error")
+	}
+}
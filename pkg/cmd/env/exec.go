@@ -12,13 +12,13 @@ import (
 )
 
 // ExecProcess executes the command with the credentials as environment variables.
-func ExecProcess(cmd []string, credentials *awssts.Credentials) error {
+func ExecProcess(cmd []string, credentials *awssts.Credentials, region string) error {
 	program, err := exec.LookPath(cmd[0])
 	if err != nil {
 		return errors.Errorf("could not find program %s on path, %s", cmd[0], err)
 	}
 
-	err = syscall.Exec(program, cmd, NewEnvironmentWithCredentials(os.Environ(), credentials))
+	err = syscall.Exec(program, cmd, NewEnvironmentWithCredentials(os.Environ(), credentials, region))
 	if err != nil {
 		return errors.Errorf("could not exec %s, %s", program, err)
 	}
@@ -32,29 +32,24 @@ func splitEnvironmentVariable(envEntry string) (string, string) {
 }
 
 // NewEnvironmentWithCredentials creates a new environment variable array adding the environment variables AWS_ACCESS_KEY_ID,
-// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
-func NewEnvironmentWithCredentials(env []string, credentials *awssts.Credentials) []string {
-	result := make([]string, 0, len(env)+3)
-	credentialValues := map[string]*string{
-		"AWS_ACCESS_KEY_ID":     credentials.AccessKeyId,
-		"AWS_SECRET_ACCESS_KEY": credentials.SecretAccessKey,
-		"AWS_SESSION_TOKEN":     credentials.SessionToken,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and AWS_CREDENTIAL_EXPIRATION, and AWS_REGION and AWS_DEFAULT_REGION if a region is specified.
+func NewEnvironmentWithCredentials(env []string, credentials *awssts.Credentials, region string) []string {
+	variables := CredentialVariables(credentials, region)
+	result := make([]string, 0, len(env)+len(variables))
+	replaced := make(map[string]bool, len(variables))
+	for _, variable := range variables {
+		replaced[variable.Name] = true
 	}
 
 	for _, envEntry := range env {
 		name, _ := splitEnvironmentVariable(envEntry)
-		if _, ok := credentialValues[name]; !ok {
+		if !replaced[name] {
 			result = append(result, envEntry)
 		}
 	}
 
-	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
-		value, _ := credentialValues[name]
-		if value != nil {
-			result = append(result, fmt.Sprintf("%s=%s", name, *value))
-		} else {
-			result = append(result, fmt.Sprintf("%s=", name))
-		}
+	for _, variable := range variables {
+		result = append(result, fmt.Sprintf("%s=%s", variable.Name, variable.Value))
 	}
 
 	return result
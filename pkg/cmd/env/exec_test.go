@@ -3,7 +3,9 @@ package env
 import (
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	awssts "github.com/aws/aws-sdk-go/service/sts"
 )
 
@@ -38,9 +40,28 @@ func TestNewEnvironmentWithCredentials(t *testing.T) {
 				SessionToken:    &tt.args.SessionToken,
 			}
 
-			if got := NewEnvironmentWithCredentials(tt.args.env, &credentials); !reflect.DeepEqual(got, tt.want) {
+			if got := NewEnvironmentWithCredentials(tt.args.env, &credentials, ""); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewEnvironmentWithCredentials() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestNewEnvironmentWithRegionAndExpiration(t *testing.T) {
+	credentials := awssts.Credentials{
+		AccessKeyId:     aws.String("key"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)),
+	}
+	env := []string{"A=B", "AWS_REGION=us-east-1", "AWS_CREDENTIAL_EXPIRATION=2023-10-01T11:00:00Z"}
+	want := []string{
+		"A=B",
+		"AWS_ACCESS_KEY_ID=key", "AWS_SECRET_ACCESS_KEY=secret", "AWS_SESSION_TOKEN=token",
+		"AWS_CREDENTIAL_EXPIRATION=2023-10-01T12:00:00Z",
+		"AWS_REGION=eu-west-1", "AWS_DEFAULT_REGION=eu-west-1",
+	}
+	if got := NewEnvironmentWithCredentials(env, &credentials, "eu-west-1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("NewEnvironmentWithCredentials() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package env
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats the supported output formats of the environment variables.
+var Formats = []string{"dotenv", "fish", "powershell", "json", "docker", "kubernetes", "github"}
+
+// Format the output format of the environment variables.
+type Format struct {
+	Name       string
+	Export     bool
+	SecretName string
+}
+
+// AddFlags adds the flags selecting the output format to the command. The format defaults to
+// $GITLAB_AWS_ENV_FORMAT or dotenv.
+func (f *Format) AddFlags(c *cobra.Command) {
+	if f.Name = os.Getenv("GITLAB_AWS_ENV_FORMAT"); f.Name == "" {
+		f.Name = "dotenv"
+	}
+	c.Flags().BoolVarP(&f.Export, "export", "e", false, "prefix variables with export keyword")
+	c.Flags().StringVarP(&f.Name, "format", "F", f.Name, "the output format: "+strings.Join(Formats, ", "))
+	c.Flags().StringVar(&f.SecretName, "secret-name", "aws-credentials", "the name of the secret in the kubernetes format")
+}
+
+// Validate returns an error if the format is not supported.
+func (f *Format) Validate() error {
+	for _, name := range Formats {
+		if f.Name == name {
+			return nil
+		}
+	}
+	return errors.Errorf("invalid format %s, expected one of %s", f.Name, strings.Join(Formats, ", "))
+}
+
+// Write writes the environment variables to w in the format.
+func (f *Format) Write(w io.Writer, variables []Variable) error {
+	switch f.Name {
+	case "", "dotenv":
+		return f.writeLines(w, variables, func(v Variable) (string, error) {
+			if f.Export {
+				return fmt.Sprintf("export %s=%s\n", v.Name, v.Value), nil
+			}
+			return fmt.Sprintf("%s=%s\n", v.Name, v.Value), nil
+		})
+	case "fish":
+		return f.writeLines(w, variables, func(v Variable) (string, error) {
+			return fmt.Sprintf("set -gx %s '%s';\n", v.Name, strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v.Value)), nil
+		})
+	case "powershell":
+		return f.writeLines(w, variables, func(v Variable) (string, error) {
+			return fmt.Sprintf("$Env:%s = '%s'\n", v.Name, strings.ReplaceAll(v.Value, "'", "''")), nil
+		})
+	case "docker":
+		return f.writeLines(w, variables, func(v Variable) (string, error) {
+			if strings.ContainsAny(v.Value, "\r\n") {
+				return "", errors.Errorf("the value of %s contains a newline, which is not supported by the docker env file format", v.Name)
+			}
+			return fmt.Sprintf("%s=%s\n", v.Name, v.Value), nil
+		})
+	case "github":
+		return f.writeLines(w, variables, func(v Variable) (string, error) {
+			if !strings.ContainsAny(v.Value, "\r\n") {
+				return fmt.Sprintf("%s=%s\n", v.Name, v.Value), nil
+			}
+			delimiter, err := newDelimiter()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s<<%s\n%s\n%s\n", v.Name, delimiter, v.Value, delimiter), nil
+		})
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(toMap(variables))
+	case "kubernetes":
+		return f.writeSecret(w, variables)
+	default:
+		return f.Validate()
+	}
+}
+
+func (f *Format) writeLines(w io.Writer, variables []Variable, format func(Variable) (string, error)) error {
+	for _, variable := range variables {
+		line, err := format(variable)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, line); err != nil {
+			return errors.Errorf("error writing environment variable value to file, %s", err)
+		}
+	}
+	return nil
+}
+
+func (f *Format) writeSecret(w io.Writer, variables []Variable) error {
+	name := f.SecretName
+	if name == "" {
+		name = "aws-credentials"
+	}
+	secret := struct {
+		APIVersion string            `yaml:"apiVersion"`
+		Kind       string            `yaml:"kind"`
+		Metadata   map[string]string `yaml:"metadata"`
+		Type       string            `yaml:"type"`
+		StringData map[string]string `yaml:"stringData"`
+	}{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   map[string]string{"name": name},
+		Type:       "Opaque",
+		StringData: toMap(variables),
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(secret); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func toMap(variables []Variable) map[string]string {
+	result := make(map[string]string, len(variables))
+	for _, variable := range variables {
+		result[variable.Name] = variable.Value
+	}
+	return result
+}
+
+func newDelimiter() (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return "ghadelimiter_" + hex.EncodeToString(random), nil
+}
@@ -0,0 +1,65 @@
+package env
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestFormatWrite(t *testing.T) {
+	variables := []Variable{
+		{"AWS_ACCESS_KEY_ID", "key"},
+		{"AWS_SESSION_TOKEN", `it's a "token"\`},
+	}
+	tests := []struct {
+		format  Format
+		want    string
+		wantErr bool
+	}{
+		{Format{Name: "dotenv"}, "AWS_ACCESS_KEY_ID=key\nAWS_SESSION_TOKEN=it's a \"token\"\\\n", false},
+		{Format{Name: "dotenv", Export: true}, "export AWS_ACCESS_KEY_ID=key\nexport AWS_SESSION_TOKEN=it's a \"token\"\\\n", false},
+		{Format{Name: "fish"}, "set -gx AWS_ACCESS_KEY_ID 'key';\nset -gx AWS_SESSION_TOKEN 'it\\'s a \"token\"\\\\';\n", false},
+		{Format{Name: "powershell"}, "$Env:AWS_ACCESS_KEY_ID = 'key'\n$Env:AWS_SESSION_TOKEN = 'it''s a \"token\"\\'\n", false},
+		{Format{Name: "json"}, "{\n  \"AWS_ACCESS_KEY_ID\": \"key\",\n  \"AWS_SESSION_TOKEN\": \"it's a \\\"token\\\"\\\\\"\n}\n", false},
+		{Format{Name: "docker"}, "AWS_ACCESS_KEY_ID=key\nAWS_SESSION_TOKEN=it's a \"token\"\\\n", false},
+		{Format{Name: "github"}, "AWS_ACCESS_KEY_ID=key\nAWS_SESSION_TOKEN=it's a \"token\"\\\n", false},
+		{Format{Name: "kubernetes", SecretName: "deploy"}, `apiVersion: v1
+kind: Secret
+metadata:
+  name: deploy
+type: Opaque
+stringData:
+  AWS_ACCESS_KEY_ID: key
+  AWS_SESSION_TOKEN: it's a "token"\
+`, false},
+		{Format{Name: "xml"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format.Name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			err := tt.format.Write(&buffer, variables)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Write() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := buffer.String(); got != tt.want {
+				t.Errorf("Write() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatWriteMultiline(t *testing.T) {
+	variables := []Variable{{"VALUE", "line 1\nline 2"}}
+
+	var buffer bytes.Buffer
+	if err := (&Format{Name: "github"}).Write(&buffer, variables); err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile("^VALUE<<(ghadelimiter_[0-9a-f]+)\nline 1\nline 2\n(ghadelimiter_[0-9a-f]+)\n$").MatchString(buffer.String()) {
+		t.Errorf("unexpected github multiline output %s", buffer.String())
+	}
+
+	if err := (&Format{Name: "docker"}).Write(&buffer, variables); err == nil {
+		t.Errorf("expected an error writing a multiline value in docker format")
+	}
+}
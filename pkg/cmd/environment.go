@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds"
+	"github.com/pkg/errors"
+)
+
+// GetBoolFromEnvironment returns the boolean value of the environment variable, or false if it is not set.
+func GetBoolFromEnvironment(name string) (bool, error) {
+	if value := os.Getenv(name); value != "" {
+		result, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, errors.Errorf("the environment variable %s is not a boolean", name)
+		}
+		return result, nil
+	}
+	return false, nil
+}
+
+// GetSTSEndpointFromEnvironment returns the STS endpoint settings from the environment.
+func GetSTSEndpointFromEnvironment() (e gitlabcreds.STSEndpoint) {
+	for _, name := range []string{"GITLAB_AWS_STS_REGION", "AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if e.Region = os.Getenv(name); e.Region != "" {
+			break
+		}
+	}
+	for _, name := range []string{"GITLAB_AWS_STS_ENDPOINT_URL", "AWS_ENDPOINT_URL_STS"} {
+		if e.URL = os.Getenv(name); e.URL != "" {
+			break
+		}
+	}
+	e.Regional, _ = GetBoolFromEnvironment("GITLAB_AWS_STS_REGIONAL_ENDPOINT")
+	e.UseFIPS, _ = GetBoolFromEnvironment("GITLAB_AWS_USE_FIPS_ENDPOINT")
+	e.UseDualStack, _ = GetBoolFromEnvironment("GITLAB_AWS_USE_DUALSTACK_ENDPOINT")
+	return e
+}
+
+// ValidateSTSEndpointEnvironment returns an error if any of the STS endpoint environment variables is invalid.
+func ValidateSTSEndpointEnvironment() error {
+	for _, name := range []string{"GITLAB_AWS_STS_REGIONAL_ENDPOINT", "GITLAB_AWS_USE_FIPS_ENDPOINT", "GITLAB_AWS_USE_DUALSTACK_ENDPOINT"} {
+		if _, err := GetBoolFromEnvironment(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSessionPolicyFromEnvironment returns the session policy settings from the environment.
+func GetSessionPolicyFromEnvironment() gitlabcreds.SessionPolicy {
+	return gitlabcreds.SessionPolicy{
+		Policy:     os.Getenv("GITLAB_AWS_POLICY"),
+		PolicyFile: os.Getenv("GITLAB_AWS_POLICY_FILE"),
+		PolicyArns: strings.FieldsFunc(os.Getenv("GITLAB_AWS_POLICY_ARNS"), func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\n' || r == '\t'
+		}),
+	}
+}
+
+// GetRetryPolicyFromEnvironment returns the retry policy from the environment, or the default of 5 attempts within one minute.
+func GetRetryPolicyFromEnvironment() gitlabcreds.RetryPolicy {
+	p := gitlabcreds.DefaultRetryPolicy()
+	p.MaxAttempts, _ = GetMaxAttemptsFromEnvironment()
+	p.Deadline, _ = GetRetryDeadlineFromEnvironment()
+	return p
+}
+
+// GetMaxAttemptsFromEnvironment returns the integer value from GITLAB_AWS_MAX_ATTEMPTS or the default 5 if it does not exist.
+// on an invalid integer value, returns the default value and err set.
+func GetMaxAttemptsFromEnvironment() (attempts int, err error) {
+	attempts = 5
+	if value := os.Getenv("GITLAB_AWS_MAX_ATTEMPTS"); value != "" {
+		var a int
+		if a, err = strconv.Atoi(value); err == nil && a > 0 {
+			return a, nil
+		}
+		return attempts, errors.New("the environment variable GITLAB_AWS_MAX_ATTEMPTS is not a positive integer")
+	}
+	return attempts, nil
+}
+
+// GetRetryDeadlineFromEnvironment returns the duration from GITLAB_AWS_RETRY_DEADLINE or the default of 1 minute.
+// on an invalid duration, returns the default value and err set.
+func GetRetryDeadlineFromEnvironment() (deadline time.Duration, err error) {
+	deadline = time.Minute
+	if value := os.Getenv("GITLAB_AWS_RETRY_DEADLINE"); value != "" {
+		var d time.Duration
+		if d, err = time.ParseDuration(value); err == nil && d > 0 {
+			return d, nil
+		}
+		return deadline, errors.New("the environment variable GITLAB_AWS_RETRY_DEADLINE is not a valid positive duration")
+	}
+	return deadline, nil
+}
+
+// GetRefreshMarginFromEnvironment returns the duration from GITLAB_AWS_REFRESH_MARGIN or the default of 5 minutes.
+// on an invalid duration, returns the default value and err set.
+func GetRefreshMarginFromEnvironment() (margin time.Duration, err error) {
+	margin = 5 * time.Minute
+	if value := os.Getenv("GITLAB_AWS_REFRESH_MARGIN"); value != "" {
+		var d time.Duration
+		if d, err = time.ParseDuration(value); err == nil && d >= 0 {
+			return d, nil
+		}
+		return margin, errors.New("the environment variable GITLAB_AWS_REFRESH_MARGIN is not a valid non-negative duration")
+	}
+	return margin, nil
+}
+
+// GetRoleChainFromEnvironment returns the white space separated hop specifications from GITLAB_AWS_ROLE_CHAIN.
+func GetRoleChainFromEnvironment() []string {
+	return strings.Fields(os.Getenv("GITLAB_AWS_ROLE_CHAIN"))
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import "testing"
+
+func TestGetSTSEndpointFromEnvironment(t *testing.T) {
+	mustSetenv(t, "GITLAB_AWS_STS_REGION", "")
+	mustSetenv(t, "AWS_REGION", "eu-central-1")
+	mustSetenv(t, "GITLAB_AWS_STS_REGIONAL_ENDPOINT", "true")
+	mustSetenv(t, "GITLAB_AWS_STS_ENDPOINT_URL", "http://localhost:8080")
+	defer func() {
+		for _, name := range []string{"AWS_REGION", "GITLAB_AWS_STS_REGIONAL_ENDPOINT", "GITLAB_AWS_STS_ENDPOINT_URL"} {
+			mustSetenv(t, name, "")
+		}
+	}()
+
+	e := GetSTSEndpointFromEnvironment()
+	if e.Region != "eu-central-1" || !e.Regional || e.URL != "http://localhost:8080" || e.UseFIPS || e.UseDualStack {
+		t.Errorf("unexpected defaults %+v", e)
+	}
+}
@@ -0,0 +1,120 @@
+package imds
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/env"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/serve"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Cmd to serve the credentials through an emulated instance metadata service.
+type Cmd struct {
+	cmd.RootCommand
+	Address     string
+	Filename    string
+	Format      env.Format
+	AllowIMDSv1 bool
+}
+
+// NewCmd creates a command to serve the credentials through an emulated instance metadata service.
+func NewCmd() *cobra.Command {
+	c := Cmd{
+		RootCommand: cmd.RootCommand{
+			Command: cobra.Command{
+				Use:   "imds",
+				Short: "serves the credentials through an emulated EC2 instance metadata service",
+				Long: `
+Starts a local HTTP server emulating the EC2 instance metadata service (IMDSv2), returning the credentials
+of the role as instance profile credentials on /latest/meta-data/iam/security-credentials/<role name>.
+The command is run with the environment variable AWS_EC2_METADATA_SERVICE_ENDPOINT pointing to the server,
+so that tools which only fall back to the instance metadata service work unmodified. The credentials
+are refreshed using the id token before they expire.
+
+Without a command, the environment variables are written to the env file or stdout, and the server runs
+until it is terminated. Tools ignoring AWS_EC2_METADATA_SERVICE_ENDPOINT require the server to listen
+on 169.254.169.254:80.
+
+	imds-demo:
+	  stage: build
+	  image:
+		name: hashicorp/packer:1.9
+		entrypoint: [""]
+	  id_tokens:
+		GITLAB_AWS_IDENTITY_TOKEN:
+		  aud: https://gitlab.com
+	  script:
+		- ./gitlab-aws-credential-helper imds -- packer build .
+	  needs:
+		- get-credential-helper
+`,
+			},
+		},
+	}
+
+	c.AddPersistentFlags()
+	if c.Address = os.Getenv("GITLAB_AWS_IMDS_ADDRESS"); c.Address == "" {
+		c.Address = "127.0.0.1:0"
+	}
+	c.Flags().StringVarP(&c.Address, "listen", "l", c.Address, "the address to listen on (default $GITLAB_AWS_IMDS_ADDRESS)")
+	c.Flags().StringVarP(&c.Filename, "filename", "f", "", "the name of the env file, when no command is specified")
+	c.Format.AddFlags(&c.Command)
+	c.Flags().BoolVar(&c.AllowIMDSv1, "allow-imdsv1", false, "allow requests without an IMDSv2 session token")
+	c.Flags().DurationVarP(&c.RefreshMargin, "refresh-margin", "m", c.RefreshMargin, "refresh the credentials expiring within this margin (default $GITLAB_AWS_REFRESH_MARGIN)")
+
+	c.PreRunE = func(_ *cobra.Command, args []string) error {
+		if c.Filename != "" && len(args) > 0 {
+			return errors.New("either specify an output file or a command to execute")
+		}
+		if err := c.Format.Validate(); err != nil {
+			return err
+		}
+		_, err := cmd.GetRefreshMarginFromEnvironment()
+		return err
+	}
+
+	c.RunE = func(_ *cobra.Command, args []string) error {
+		roleArn, err := gitlabcreds.ParseRoleArn(c.RoleArns()[len(c.RoleArns())-1])
+		if err != nil {
+			return err
+		}
+		region := c.Region
+		if region == "" {
+			region = c.STSEndpoint.Region
+		}
+		server := &Server{
+			RoleName:    roleArn.Name,
+			Region:      region,
+			AllowIMDSv1: c.AllowIMDSv1,
+			Credentials: c.GetCredentials,
+		}
+		if err = server.Start(c.Address); err != nil {
+			return errors.Errorf("failed to listen on %s, %s", c.Address, err)
+		}
+		defer server.Close()
+
+		variables := []env.Variable{
+			{Name: "AWS_EC2_METADATA_SERVICE_ENDPOINT", Value: server.URL()},
+			{Name: "AWS_EC2_METADATA_DISABLED", Value: "false"},
+		}
+		variables = append(variables, env.RegionVariables(c.Region)...)
+		if len(args) > 0 {
+			return serve.RunProcess(&c.Command, args, serve.NewEnvironment(os.Environ(), variables))
+		}
+
+		if err = env.WriteVariables(c.Filename, c.Format, variables); err != nil {
+			return err
+		}
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		return nil
+	}
+
+	return &c.Command
+}
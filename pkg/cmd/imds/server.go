@@ -0,0 +1,170 @@
+package imds
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/serve"
+)
+
+const (
+	// TokenPath the path of the IMDSv2 session token handshake.
+	TokenPath = "/latest/api/token"
+	// SecurityCredentialsPath the path listing the role, and returning the credentials of the role.
+	SecurityCredentialsPath = "/latest/meta-data/iam/security-credentials/"
+	// RegionPath the path returning the region.
+	RegionPath = "/latest/meta-data/placement/region"
+
+	tokenHeader    = "X-aws-ec2-metadata-token"
+	tokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	maxTokenTTL    = 21600
+)
+
+// SecurityCredentials the response of the security credentials endpoint.
+type SecurityCredentials struct {
+	Code            string
+	LastUpdated     string
+	Type            string
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	Expiration      string
+}
+
+// Server emulates the EC2 instance metadata service for the instance profile credentials.
+type Server struct {
+	RoleName    string
+	Region      string
+	AllowIMDSv1 bool
+	Credentials serve.CredentialsFunc
+	background  serve.BackgroundServer
+	mutex       sync.Mutex
+	tokens      map[string]time.Time
+	now         func() time.Time
+}
+
+func (s *Server) currentTime() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+func (s *Server) newToken(ttl time.Duration) (string, error) {
+	token, err := serve.NewAuthorizationToken()
+	if err != nil {
+		return "", err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.tokens == nil {
+		s.tokens = make(map[string]time.Time)
+	}
+	now := s.currentTime()
+	for t, expiration := range s.tokens {
+		if now.After(expiration) {
+			delete(s.tokens, t)
+		}
+	}
+	s.tokens[token] = now.Add(ttl)
+	return token, nil
+}
+
+func (s *Server) isValidToken(token string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	expiration, found := s.tokens[token]
+	return found && s.currentTime().Before(expiration)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ttl, err := strconv.Atoi(r.Header.Get(tokenTTLHeader))
+	if err != nil || ttl < 1 || ttl > maxTokenTTL {
+		http.Error(w, "invalid "+tokenTTLHeader, http.StatusBadRequest)
+		return
+	}
+	token, err := s.newToken(time.Duration(ttl) * time.Second)
+	if err != nil {
+		http.Error(w, "failed to create token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(tokenTTLHeader, strconv.Itoa(ttl))
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(token))
+}
+
+// ServeHTTP implements the IMDSv2 token handshake and the security credentials endpoints.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == TokenPath {
+		s.handleToken(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if token := r.Header.Get(tokenHeader); !s.isValidToken(token) && (token != "" || !s.AllowIMDSv1) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == RegionPath && s.Region != "":
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(s.Region))
+	case r.URL.Path == SecurityCredentialsPath:
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(s.RoleName))
+	case r.URL.Path == SecurityCredentialsPath+s.RoleName:
+		s.handleCredentials(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) handleCredentials(w http.ResponseWriter) {
+	credentials, err := s.Credentials()
+	if err != nil {
+		log.Printf("ERROR: failed to get credentials, %s", err)
+		http.Error(w, "failed to get credentials", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(SecurityCredentials{
+		Code:            "Success",
+		LastUpdated:     s.currentTime().UTC().Format(time.RFC3339),
+		Type:            "AWS-HMAC",
+		AccessKeyId:     aws.StringValue(credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(credentials.SecretAccessKey),
+		Token:           aws.StringValue(credentials.SessionToken),
+		Expiration:      aws.TimeValue(credentials.Expiration).UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Printf("WARNING: failed to write credentials response, %s", err)
+	}
+}
+
+// Start listens on the address and serves the requests in the background.
+func (s *Server) Start(address string) error {
+	s.background.Name = "instance metadata server"
+	return s.background.Start(address, s)
+}
+
+// URL returns the endpoint of the instance metadata service.
+func (s *Server) URL() string {
+	return s.background.URL()
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.background.Close()
+}
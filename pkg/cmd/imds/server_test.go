@@ -0,0 +1,96 @@
+package imds
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awssts "github.com/aws/aws-sdk-go/service/sts"
+)
+
+func newTestServer(now *time.Time) *Server {
+	return &Server{
+		RoleName: "deployer",
+		Region:   "eu-west-1",
+		Credentials: func() (*awssts.Credentials, error) {
+			return &awssts.Credentials{
+				AccessKeyId:     aws.String("key"),
+				SecretAccessKey: aws.String("secret"),
+				SessionToken:    aws.String("token"),
+				Expiration:      aws.Time(now.Add(time.Hour)),
+			}, nil
+		},
+		now: func() time.Time { return *now },
+	}
+}
+
+func request(server *Server, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, r)
+	return response
+}
+
+func TestServer(t *testing.T) {
+	now := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	server := newTestServer(&now)
+
+	if response := request(server, http.MethodPut, TokenPath, nil); response.Code != http.StatusBadRequest {
+		t.Errorf("expected a token request without ttl to fail, got %d", response.Code)
+	}
+	if response := request(server, http.MethodPut, TokenPath, map[string]string{tokenTTLHeader: "21601"}); response.Code != http.StatusBadRequest {
+		t.Errorf("expected a token request with a ttl too large to fail, got %d", response.Code)
+	}
+	if response := request(server, http.MethodGet, SecurityCredentialsPath, nil); response.Code != http.StatusUnauthorized {
+		t.Errorf("expected an IMDSv1 request to be unauthorized, got %d", response.Code)
+	}
+
+	response := request(server, http.MethodPut, TokenPath, map[string]string{tokenTTLHeader: "60"})
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected a session token, got %d", response.Code)
+	}
+	token := map[string]string{tokenHeader: response.Body.String()}
+
+	if response = request(server, http.MethodGet, SecurityCredentialsPath, token); response.Body.String() != "deployer" {
+		t.Errorf("expected role name deployer, got %s", response.Body.String())
+	}
+	if response = request(server, http.MethodGet, RegionPath, token); response.Body.String() != "eu-west-1" {
+		t.Errorf("expected region eu-west-1, got %s", response.Body.String())
+	}
+	if response = request(server, http.MethodGet, SecurityCredentialsPath+"other", token); response.Code != http.StatusNotFound {
+		t.Errorf("expected an unknown role to be not found, got %d", response.Code)
+	}
+
+	response = request(server, http.MethodGet, SecurityCredentialsPath+"deployer", token)
+	var credentials SecurityCredentials
+	if err := json.Unmarshal(response.Body.Bytes(), &credentials); err != nil {
+		t.Fatal(err)
+	}
+	want := SecurityCredentials{"Success", "2023-11-14T22:13:20Z", "AWS-HMAC", "key", "secret", "token", "2023-11-14T23:13:20Z"}
+	if credentials != want {
+		t.Errorf("expected %v, got %v", want, credentials)
+	}
+
+	now = now.Add(61 * time.Second)
+	if response = request(server, http.MethodGet, SecurityCredentialsPath, token); response.Code != http.StatusUnauthorized {
+		t.Errorf("expected an expired session token to be unauthorized, got %d", response.Code)
+	}
+}
+
+func TestServerAllowIMDSv1(t *testing.T) {
+	now := time.Now()
+	server := newTestServer(&now)
+	server.AllowIMDSv1 = true
+	if response := request(server, http.MethodGet, SecurityCredentialsPath, nil); response.Code != http.StatusOK {
+		t.Errorf("expected an IMDSv1 request to be allowed, got %d", response.Code)
+	}
+	if response := request(server, http.MethodGet, SecurityCredentialsPath, map[string]string{tokenHeader: "invalid"}); response.Code != http.StatusUnauthorized {
+		t.Errorf("expected an invalid session token to be unauthorized, got %d", response.Code)
+	}
+}
@@ -0,0 +1,338 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// HelperMarker the comment marking the sections written by the credential helper in the AWS credentials
+// and config files, so that they can be told apart from hand-written sections when cleaning up.
+const HelperMarker = "# written by gitlab-aws-credential-helper"
+
+// IniFile is an ini file which is edited line by line, so that comments, ordering, formatting and line endings
+// are preserved and untouched sections remain byte for byte identical.
+type IniFile struct {
+	lines []string
+}
+
+// ParseIniFile splits the content of the ini file into lines.
+func ParseIniFile(content []byte) *IniFile {
+	text := strings.TrimSuffix(string(content), "\n")
+	if text == "" {
+		return &IniFile{}
+	}
+	return &IniFile{lines: strings.Split(text, "\n")}
+}
+
+// Bytes returns the content of the ini file.
+func (f *IniFile) Bytes() []byte {
+	if len(f.lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(f.lines, "\n") + "\n")
+}
+
+func sectionHeader(line string) (name string, ok bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") {
+		return "", false
+	}
+	end := strings.Index(line, "]")
+	if end < 0 {
+		return "", false
+	}
+	return strings.TrimSpace(line[1:end]), true
+}
+
+func isComment(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";")
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// keyValue parses a key = value line. Indented lines are nested values of the preceding key, and are not returned.
+func keyValue(line string) (key, value string, ok bool) {
+	if isBlank(line) || isComment(line) || line[0] == ' ' || line[0] == '\t' {
+		return "", "", false
+	}
+	key, value, ok = strings.Cut(line, "=")
+	return strings.TrimSpace(key), strings.TrimSpace(value), ok
+}
+
+// section returns the line index of the header of the section, and of the first line after its body.
+func (f *IniFile) section(name string) (start, end int, found bool) {
+	for i, line := range f.lines {
+		if header, ok := sectionHeader(line); ok {
+			if found {
+				return start, i, true
+			}
+			if header == name {
+				start, found = i, true
+			}
+		}
+	}
+	return start, len(f.lines), found
+}
+
+// Sections returns the names of the sections in the order of the file.
+func (f *IniFile) Sections() []string {
+	var result []string
+	for _, line := range f.lines {
+		if name, ok := sectionHeader(line); ok {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// HasSection returns true if the file contains the section.
+func (f *IniFile) HasSection(name string) bool {
+	_, _, found := f.section(name)
+	return found
+}
+
+// Value returns the value of the key in the section. found is false if the section or key does not exist.
+func (f *IniFile) Value(section, key string) (value string, found bool) {
+	start, end, found := f.section(section)
+	if !found {
+		return "", false
+	}
+	for _, line := range f.lines[start+1 : end] {
+		if k, v, ok := keyValue(line); ok && k == key {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func (f *IniFile) insert(index int, lines ...string) {
+	f.lines = append(f.lines[:index], append(lines, f.lines[index:]...)...)
+}
+
+// lineEnding returns the carriage return ending the line, if any, as the lines are split on newlines only.
+func lineEnding(line string) string {
+	return line[len(strings.TrimSuffix(line, "\r")):]
+}
+
+// newLines returns the lines with the carriage return of the file appended, so that added lines match the
+// CRLF line endings of a file written on Windows.
+func (f *IniFile) newLines(lines ...string) []string {
+	if len(f.lines) == 0 || lineEnding(f.lines[0]) == "" {
+		return lines
+	}
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		result[i] = line + "\r"
+	}
+	return result
+}
+
+// SetValue sets the value of the key in the section, preserving the formatting of an existing key. A new key
+// is added after the last key of the section, and a new section is added at the end of the file.
+func (f *IniFile) SetValue(section, key, value string) {
+	start, end, found := f.section(section)
+	if !found {
+		if len(f.lines) > 0 && !isBlank(f.lines[len(f.lines)-1]) {
+			f.lines = append(f.lines, f.newLines("")...)
+		}
+		f.lines = append(f.lines, f.newLines("["+section+"]", key+" = "+value)...)
+		return
+	}
+
+	last := start
+	for i := start + 1; i < end; i++ {
+		line := f.lines[i]
+		if k, _, ok := keyValue(line); ok && k == key {
+			separator := strings.Index(line, "=") + 1
+			whitespace := line[separator:]
+			whitespace = whitespace[:len(whitespace)-len(strings.TrimLeft(whitespace, " \t"))]
+			if whitespace == "" {
+				whitespace = " "
+			}
+			f.lines[i] = line[:separator] + whitespace + value + lineEnding(line)
+			return
+		}
+		if !isBlank(line) && !isComment(line) {
+			last = i
+		}
+	}
+	f.insert(last+1, f.newLines(key+" = "+value)...)
+}
+
+// comments returns the index of the first line of the comment block directly above the line.
+func (f *IniFile) comments(index int) int {
+	for index > 0 && isComment(f.lines[index-1]) {
+		index--
+	}
+	return index
+}
+
+// DeleteSection removes the section, and the helper marker above it. Comments directly above the next
+// section belong to that section, and are retained.
+func (f *IniFile) DeleteSection(name string) {
+	start, end, found := f.section(name)
+	if !found {
+		return
+	}
+	for start > 0 && strings.TrimSpace(f.lines[start-1]) == HelperMarker {
+		start--
+	}
+	if end < len(f.lines) {
+		end = f.comments(end)
+	}
+	f.lines = append(f.lines[:start], f.lines[end:]...)
+	for len(f.lines) > 0 && isBlank(f.lines[len(f.lines)-1]) {
+		f.lines = f.lines[:len(f.lines)-1]
+	}
+}
+
+// MarkSection adds the helper marker directly above the section header, if not already present.
+func (f *IniFile) MarkSection(name string) {
+	if start, _, found := f.section(name); found && !f.IsMarkedSection(name) {
+		f.insert(start, f.newLines(HelperMarker)...)
+	}
+}
+
+// IsMarkedSection returns true if the section was written by the credential helper.
+func (f *IniFile) IsMarkedSection(name string) bool {
+	start, _, found := f.section(name)
+	if !found {
+		return false
+	}
+	for _, line := range f.lines[f.comments(start):start] {
+		if strings.TrimSpace(line) == HelperMarker {
+			return true
+		}
+	}
+	return false
+}
+
+// LockFilename returns the name of the lock file guarding the updates of the file, in the locks directory of the
+// user cache directory, so that no lock file is left beside the file. The lock file cannot be removed after the
+// update, as a process waiting for the lock would hold a lock on the removed file.
+func LockFilename(filename string) string {
+	if absolute, err := filepath.Abs(filename); err == nil {
+		filename = absolute
+	}
+	hash := sha256.Sum256([]byte(filename))
+	directory := filepath.Join(os.TempDir(), "gitlab-aws-credential-helper", "locks")
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		directory = filepath.Join(cacheDir, "gitlab-aws-credential-helper", "locks")
+	}
+	return filepath.Join(directory, hex.EncodeToString(hash[:])+".lock")
+}
+
+// UpdateIniFile reads the ini file, applies the update and writes the file if the content changed. A missing
+// file is treated as empty. The read-modify-write is guarded by an advisory lock on the LockFilename of the
+// file, so that concurrent updates do not lose each other's changes. With dryRun, the changes are written as
+// a unified diff to stdout instead, with the secrets masked.
+func UpdateIniFile(filename string, dryRun bool, update func(file *IniFile) error) error {
+	if target, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = target
+	}
+
+	if !dryRun {
+		if err := os.MkdirAll(filepath.Dir(filename), 0o750); err != nil {
+			return errors.Errorf("failed to create directory for %s, %s", filename, err)
+		}
+		lockFilename := LockFilename(filename)
+		if err := os.MkdirAll(filepath.Dir(lockFilename), 0o700); err != nil {
+			return errors.Errorf("failed to create directory for %s, %s", lockFilename, err)
+		}
+		lock, err := LockFile(lockFilename)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := lock.Unlock(); err != nil {
+				log.Printf("WARNING: failed to unlock %s, %s", lockFilename, err)
+			}
+		}()
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	file := ParseIniFile(content)
+	if err = update(file); err != nil {
+		return err
+	}
+
+	updated := file.Bytes()
+	if bytes.Equal(content, updated) {
+		if dryRun {
+			log.Printf("no changes to %s", filename)
+		}
+		return nil
+	}
+	if dryRun {
+		_, err = os.Stdout.WriteString(Diff(filename, MaskSecrets(content), MaskSecrets(updated)))
+		return err
+	}
+	return WriteFileAtomic(filename, updated)
+}
+
+// SecretKeys the keys of which the values are masked in the output of a dry run.
+var SecretKeys = []string{"aws_secret_access_key", "aws_session_token"}
+
+// MaskSecrets replaces the values of the secret keys in the content of the ini file.
+func MaskSecrets(content []byte) []byte {
+	file := ParseIniFile(content)
+	for i, line := range file.lines {
+		if key, value, ok := keyValue(line); ok && value != "" {
+			for _, secret := range SecretKeys {
+				if key == secret {
+					file.lines[i] = line[:strings.Index(line, "=")+1] + " ****" + lineEnding(line)
+				}
+			}
+		}
+	}
+	return file.Bytes()
+}
+
+// WriteFileAtomic writes the content to a temporary file in the same directory and renames it to the filename,
+// so that readers never see a partially written file. The permissions of an existing file are preserved, except
+// for the execute bits, a new file is readable only by the owner.
+func WriteFileAtomic(filename string, content []byte) error {
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm() &^ 0o111
+	}
+	return WriteFileAtomicMode(filename, content, mode)
+}
+
+// WriteFileAtomicMode writes the content atomically as WriteFileAtomic, with the specified permissions.
+func WriteFileAtomicMode(filename string, content []byte, mode os.FileMode) error {
+	file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(content); err == nil {
+		err = file.Chmod(mode)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filename)
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return errors.Errorf("failed to write %s, %s", filename, err)
+	}
+	return nil
+}
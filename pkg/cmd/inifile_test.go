@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const credentialsFile = `# my credentials
+[manual]
+aws_access_key_id=AKIA
+aws_secret_access_key =  secret
+
+; staging
+[staging]
+aws_access_key_id = ASIA
+region    = eu-west-1
+s3 =
+  max_concurrent_requests = 10
+
+# production
+[production]
+aws_access_key_id = ASIA
+`
+
+func TestIniFileSetValue(t *testing.T) {
+	file := ParseIniFile([]byte(credentialsFile))
+	file.SetValue("staging", "region", "eu-central-1")
+	file.SetValue("staging", "aws_session_token", "token")
+	file.SetValue("new", "aws_access_key_id", "key")
+	file.MarkSection("new")
+	file.MarkSection("new")
+
+	want := `# my credentials
+[manual]
+aws_access_key_id=AKIA
+aws_secret_access_key =  secret
+
+; staging
+[staging]
+aws_access_key_id = ASIA
+region    = eu-central-1
+s3 =
+  max_concurrent_requests = 10
+aws_session_token = token
+
+# production
+[production]
+aws_access_key_id = ASIA
+
+# written by gitlab-aws-credential-helper
+[new]
+aws_access_key_id = key
+`
+	if got := string(file.Bytes()); got != want {
+		t.Errorf("SetValue() = \n%s\nwant\n%s", got, want)
+	}
+	if value, found := file.Value("manual", "aws_secret_access_key"); !found || value != "secret" {
+		t.Errorf("Value() = %s, %v", value, found)
+	}
+	if !file.IsMarkedSection("new") || file.IsMarkedSection("production") {
+		t.Errorf("expected only section new to be marked")
+	}
+}
+
+func TestIniFileSetValueCRLF(t *testing.T) {
+	file := ParseIniFile([]byte("[default]\r\nregion = eu-west-1\r\naws_secret_access_key = secret\r\n"))
+	file.SetValue("default", "region", "eu-central-1")
+	file.SetValue("default", "aws_session_token", "token")
+	file.SetValue("new", "aws_access_key_id", "key")
+	file.MarkSection("new")
+
+	want := "[default]\r\nregion = eu-central-1\r\naws_secret_access_key = secret\r\naws_session_token = token\r\n\r\n" +
+		"# written by gitlab-aws-credential-helper\r\n[new]\r\naws_access_key_id = key\r\n"
+	if got := string(file.Bytes()); got != want {
+		t.Errorf("SetValue() = %q, want %q", got, want)
+	}
+	if value, _ := file.Value("default", "region"); value != "eu-central-1" {
+		t.Errorf("Value() = %q, want eu-central-1", value)
+	}
+	if got := string(MaskSecrets(file.Bytes())); !strings.Contains(got, "aws_secret_access_key = ****\r\n") {
+		t.Errorf("expected the masked secret to keep its line ending, got %q", got)
+	}
+}
+
+func TestIniFileDeleteSection(t *testing.T) {
+	tests := []struct {
+		name    string
+		section string
+		want    string
+	}{
+		{
+			name:    "first",
+			section: "manual",
+			want:    "# my credentials\n; staging\n[staging]\naws_access_key_id = ASIA\nregion    = eu-west-1\ns3 =\n  max_concurrent_requests = 10\n\n# production\n[production]\naws_access_key_id = ASIA\n",
+		},
+		{
+			name:    "middle",
+			section: "staging",
+			want:    "# my credentials\n[manual]\naws_access_key_id=AKIA\naws_secret_access_key =  secret\n\n; staging\n# production\n[production]\naws_access_key_id = ASIA\n",
+		},
+		{
+			name:    "last",
+			section: "production",
+			want:    "# my credentials\n[manual]\naws_access_key_id=AKIA\naws_secret_access_key =  secret\n\n; staging\n[staging]\naws_access_key_id = ASIA\nregion    = eu-west-1\ns3 =\n  max_concurrent_requests = 10\n\n# production\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := ParseIniFile([]byte(credentialsFile))
+			file.DeleteSection(tt.section)
+			if got := string(file.Bytes()); got != tt.want {
+				t.Errorf("DeleteSection() = \n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	file := ParseIniFile([]byte("[a]\nx = 1\n\n" + HelperMarker + "\n[b]\ny = 2\n"))
+	file.DeleteSection("b")
+	if got := string(file.Bytes()); got != "[a]\nx = 1\n" {
+		t.Errorf("expected the marker to be removed with the section, got\n%s", got)
+	}
+}
+
+func TestMaskSecrets(t *testing.T) {
+	got := string(MaskSecrets([]byte("[a]\naws_access_key_id = key\naws_secret_access_key = secret\naws_session_token=token\n")))
+	want := "[a]\naws_access_key_id = key\naws_secret_access_key = ****\naws_session_token= ****\n"
+	if got != want {
+		t.Errorf("MaskSecrets() = %s, want %s", got, want)
+	}
+}
+
+func TestUpdateIniFileConcurrently(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	filename := filepath.Join(t.TempDir(), ".aws", "credentials")
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = UpdateIniFile(filename, false, func(file *IniFile) error {
+				file.SetValue(fmt.Sprintf("profile-%d", i), "aws_access_key_id", "key")
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := ParseIniFile(content)
+	for i := range errs {
+		if !file.HasSection(fmt.Sprintf("profile-%d", i)) {
+			t.Errorf("profile-%d was lost", i)
+		}
+	}
+	if info, err := os.Stat(filename); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected new file to have mode 0600, got %o", info.Mode().Perm())
+	}
+	if entries, err := os.ReadDir(filepath.Dir(filename)); err != nil || len(entries) != 1 {
+		t.Errorf("expected no lock file beside the credentials file, got %v, %v", entries, err)
+	}
+	if _, err := os.Stat(LockFilename(filename)); err != nil {
+		t.Errorf("expected the lock file in the cache directory, %s", err)
+	}
+}
+
+func TestUpdateIniFilePreservesPermissions(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	directory := t.TempDir()
+	filename := filepath.Join(directory, "credentials")
+	if err := os.WriteFile(filename, []byte("[default]\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filename, 0o740); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(directory, "link")
+	if err := os.Symlink(filename, link); err != nil {
+		t.Fatal(err)
+	}
+
+	err := UpdateIniFile(link, false, func(file *IniFile) error {
+		file.SetValue("default", "region", "eu-west-1")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Lstat(link); err != nil {
+		t.Fatal(err)
+	} else if info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected the symbolic link to be preserved")
+	}
+	if info, err := os.Stat(filename); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0o640 {
+		t.Errorf("expected mode 0640 without execute bits, got %o", info.Mode().Perm())
+	}
+	if content, err := os.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	} else if string(content) != "[default]\nregion = eu-west-1\n" {
+		t.Errorf("unexpected content %s", content)
+	}
+}
+
+func TestUpdateIniFileDryRun(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	filename := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(filename, []byte("[default]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err := UpdateIniFile(filename, true, func(file *IniFile) error {
+		file.SetValue("default", "region", "eu-west-1")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	} else if string(content) != "[default]\n" {
+		t.Errorf("expected the file not to change on a dry run, got %s", content)
+	}
+	if _, err := os.Stat(LockFilename(filename)); !os.IsNotExist(err) {
+		t.Errorf("expected no lock file on a dry run")
+	}
+}
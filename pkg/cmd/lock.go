@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// FileLock is an advisory lock on a file, shared between processes.
+type FileLock struct {
+	file *os.File
+}
+
+// LockFile acquires an exclusive advisory lock on the file with the specified name, creating it if
+// it does not exist. The call blocks until the lock is obtained.
+func LockFile(filename string) (*FileLock, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, errors.Errorf("failed to open lock file %s, %s", filename, err)
+	}
+	if err = lockFile(file); err != nil {
+		_ = file.Close()
+		return nil, errors.Errorf("failed to lock %s, %s", filename, err)
+	}
+	return &FileLock{file: file}, nil
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	if err := unlockFile(l.file); err != nil {
+		_ = l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,135 @@
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	awssts "github.com/aws/aws-sdk-go/service/sts"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd"
+	"github.com/pkg/errors"
+)
+
+// CredentialCache stores the credentials on disk, keyed by role arn and role session name.
+type CredentialCache struct {
+	Directory     string
+	RefreshMargin time.Duration
+}
+
+// DefaultCacheDirectory returns the cache directory from GITLAB_AWS_CACHE_DIR. If not set, it
+// returns a directory in the job workspace $CI_PROJECT_DIR, or in the user cache directory
+// ($XDG_CACHE_HOME) outside of a job.
+func DefaultCacheDirectory() string {
+	if directory := os.Getenv("GITLAB_AWS_CACHE_DIR"); directory != "" {
+		return directory
+	}
+	if projectDir := os.Getenv("CI_PROJECT_DIR"); projectDir != "" {
+		return filepath.Join(projectDir, ".gitlab-aws-credential-helper", "cache")
+	}
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(cacheDir, "gitlab-aws-credential-helper")
+	}
+	return filepath.Join(os.TempDir(), "gitlab-aws-credential-helper")
+}
+
+func (c *CredentialCache) key(roleArn, roleSessionName string) string {
+	hash := sha256.Sum256([]byte(roleArn + "\n" + roleSessionName))
+	return hex.EncodeToString(hash[:])
+}
+
+// IsValid returns true if the credentials do not expire within the refresh margin.
+func (c *CredentialCache) IsValid(credentials *awssts.Credentials, now time.Time) bool {
+	if credentials == nil || credentials.Expiration == nil ||
+		credentials.AccessKeyId == nil || credentials.SecretAccessKey == nil || credentials.SessionToken == nil {
+		return false
+	}
+	return now.Add(c.RefreshMargin).Before(*credentials.Expiration)
+}
+
+func (c *CredentialCache) read(filename string) *awssts.Credentials {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("WARNING: failed to read cached credentials from %s, %s", filename, err)
+		}
+		return nil
+	}
+	var credentials awssts.Credentials
+	if err = json.Unmarshal(content, &credentials); err != nil {
+		log.Printf("WARNING: ignoring invalid cached credentials in %s, %s", filename, err)
+		return nil
+	}
+	return &credentials
+}
+
+func (c *CredentialCache) write(filename string, credentials *awssts.Credentials) error {
+	content, err := json.Marshal(credentials)
+	if err != nil {
+		return err
+	}
+	return cmd.WriteFileAtomic(filename, content)
+}
+
+// Get returns the cached credentials for the role arn and session name if they are still valid. Otherwise
+// it obtains new credentials through refresh and stores them in the cache. Concurrent callers for the same
+// key wait for the one refreshing the credentials, and return the result.
+func (c *CredentialCache) Get(roleArn, roleSessionName string, refresh func() (*awssts.Credentials, error)) (*awssts.Credentials, error) {
+	if err := os.MkdirAll(c.Directory, 0o700); err != nil {
+		return nil, errors.Errorf("failed to create cache directory %s, %s", c.Directory, err)
+	}
+
+	filename := filepath.Join(c.Directory, c.key(roleArn, roleSessionName)+".json")
+	lock, err := cmd.LockFile(filename + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := lock.Unlock(); err != nil {
+			log.Printf("WARNING: failed to unlock %s.lock, %s", filename, err)
+		}
+	}()
+
+	if credentials := c.read(filename); c.IsValid(credentials, time.Now()) {
+		return credentials, nil
+	}
+
+	credentials, err := refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = c.write(filename, credentials); err != nil {
+		log.Printf("WARNING: failed to cache credentials in %s, %s", filename, err)
+	}
+	return credentials, nil
+}
+
+// Clear removes all cached credentials and lock files from the cache directory. Other files in the
+// directory are left alone.
+func (c *CredentialCache) Clear() error {
+	entries, err := os.ReadDir(c.Directory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".lock")
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		if key, err := hex.DecodeString(strings.TrimSuffix(name, ".json")); err != nil || len(key) != sha256.Size {
+			continue
+		}
+		if err = os.Remove(filepath.Join(c.Directory, entry.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
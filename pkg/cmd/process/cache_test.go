@@ -0,0 +1,99 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awssts "github.com/aws/aws-sdk-go/service/sts"
+)
+
+func newCredentials(expiration time.Time) *awssts.Credentials {
+	return &awssts.Credentials{
+		AccessKeyId:     aws.String("key"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(expiration),
+	}
+}
+
+func TestCredentialCacheIsValid(t *testing.T) {
+	now := time.Now()
+	cache := CredentialCache{RefreshMargin: 5 * time.Minute}
+	tests := []struct {
+		name        string
+		credentials *awssts.Credentials
+		want        bool
+	}{
+		{"no credentials", nil, false},
+		{"no expiration", &awssts.Credentials{AccessKeyId: aws.String("key")}, false},
+		{"expired", newCredentials(now.Add(-time.Minute)), false},
+		{"within refresh margin", newCredentials(now.Add(4 * time.Minute)), false},
+		{"beyond refresh margin", newCredentials(now.Add(6 * time.Minute)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cache.IsValid(tt.credentials, now); got != tt.want {
+				t.Errorf("IsValid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialCacheGet(t *testing.T) {
+	cache := CredentialCache{Directory: t.TempDir(), RefreshMargin: 5 * time.Minute}
+	calls := 0
+	refresh := func(expiration time.Time) func() (*awssts.Credentials, error) {
+		return func() (*awssts.Credentials, error) {
+			calls++
+			return newCredentials(expiration), nil
+		}
+	}
+
+	if _, err := cache.Get("arn:aws:iam::123456789012:role/role", "session", refresh(time.Now().Add(time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get("arn:aws:iam::123456789012:role/role", "session", refresh(time.Now().Add(time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("expected cached credentials to be returned, refresh was called %d times", calls)
+	}
+
+	if _, err := cache.Get("arn:aws:iam::123456789012:role/role", "other-session", refresh(time.Now().Add(time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get("arn:aws:iam::123456789012:role/role", "other-session", refresh(time.Now().Add(time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected credentials within the refresh margin to be refreshed, refresh was called %d times", calls)
+	}
+}
+
+func TestCredentialCacheClear(t *testing.T) {
+	cache := CredentialCache{Directory: t.TempDir(), RefreshMargin: 5 * time.Minute}
+	_, err := cache.Get("arn:aws:iam::123456789012:role/role", "session", func() (*awssts.Credentials, error) {
+		return newCredentials(time.Now().Add(time.Hour)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(cache.Directory, "other.json")
+	if err = os.WriteFile(other, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cache.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(cache.Directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "other.json" {
+		t.Errorf("expected only other.json to remain, got %v", entries)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/json"
 	"os"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws/credentials/processcreds"
 	"github.com/aws/aws-sdk-go/service/sts"
@@ -14,6 +15,8 @@ import (
 // Cmd to respond to the AWS credential_process
 type Cmd struct {
 	cmd.RootCommand
+	Cache   CredentialCache
+	NoCache bool
 }
 
 // NewCmd creates a command to respond as a AWS credential process
@@ -62,6 +65,37 @@ The following gitlab-ci.yml snippets shows the usage of the process command:
 	}
 
 	c.AddPersistentFlags()
+	c.Cache.Directory = DefaultCacheDirectory()
+	c.Cache.RefreshMargin, _ = cmd.GetRefreshMarginFromEnvironment()
+	c.Flags().StringVarP(&c.Cache.Directory, "cache-dir", "c", c.Cache.Directory, "the directory to cache the credentials in (default $GITLAB_AWS_CACHE_DIR)")
+	c.Flags().DurationVarP(&c.Cache.RefreshMargin, "refresh-margin", "m", c.Cache.RefreshMargin, "refresh cached credentials expiring within this margin (default $GITLAB_AWS_REFRESH_MARGIN)")
+	c.Flags().BoolVarP(&c.NoCache, "no-cache", "N", false, "do not cache the credentials")
+
+	c.PersistentPreRunE = func(_ *cobra.Command, args []string) error {
+		if err := c.ValidateEnvironment(); err != nil {
+			return err
+		}
+		if _, err := cmd.GetRefreshMarginFromEnvironment(); err != nil {
+			return err
+		}
+		if c.NoCache {
+			return c.GetSTSCredentials()
+		}
+		if err := c.ResolveRole(); err != nil {
+			return err
+		}
+		credentials, err := c.Cache.Get(c.CacheRoleIdentity(), c.RoleSessionName, func() (*sts.Credentials, error) {
+			if err := c.AssumeRole(); err != nil {
+				return nil, err
+			}
+			return c.Credentials, nil
+		})
+		if err != nil {
+			return err
+		}
+		c.Credentials = credentials
+		return nil
+	}
 
 	c.RunE = func(cmd *cobra.Command, args []string) error {
 		return WriteProcessCredentials(c.Credentials)
@@ -70,6 +104,15 @@ The following gitlab-ci.yml snippets shows the usage of the process command:
 	return &c.Command
 }
 
+// CacheRoleIdentity returns the role arns and session policies which determine the credentials, used as cache key.
+func (c *Cmd) CacheRoleIdentity() string {
+	identity := strings.Join(c.RoleArns(), " ")
+	if !c.SessionPolicy.IsEmpty() {
+		identity += "\n" + c.InlinePolicy + "\n" + strings.Join(c.SessionPolicy.PolicyArns, " ")
+	}
+	return identity
+}
+
 func WriteProcessCredentials(credentials *sts.Credentials) (err error) {
 	var encoded []byte
 
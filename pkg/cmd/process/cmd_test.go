@@ -0,0 +1,90 @@
+package process
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds/ststest"
+)
+
+// captureStdout returns what fn writes to stdout.
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	err = fn()
+	os.Stdout = stdout
+	_ = writer.Close()
+	output, readErr := io.ReadAll(reader)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	return string(output), err
+}
+
+func runProcess(t *testing.T, args ...string) (string, error) {
+	command := NewCmd()
+	command.SetArgs(args)
+	command.SilenceUsage, command.SilenceErrors = true, true
+	return captureStdout(t, command.Execute)
+}
+
+func TestProcessCommand(t *testing.T) {
+	server := ststest.NewServer()
+	defer server.Close()
+	server.Setenv(t, "arn:aws:iam::123456789012:role/gitlab-deployer")
+	t.Setenv("GITLAB_AWS_CACHE_DIR", t.TempDir())
+
+	for i := 0; i < 2; i++ {
+		output, err := runProcess(t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var response map[string]interface{}
+		if err = json.Unmarshal([]byte(output), &response); err != nil {
+			t.Fatalf("invalid credential process output %s, %s", output, err)
+		}
+		if response["Version"] != 1.0 || response["AccessKeyId"] != "ASIAFAKE000000000001" || response["Expiration"] == nil {
+			t.Errorf("unexpected credential process output %s", output)
+		}
+	}
+	if n := len(server.Requests()); n != 1 {
+		t.Errorf("expected the second call to use the cached credentials, got %d requests", n)
+	}
+
+	if _, err := runProcess(t, "--no-cache"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(server.Requests()); n != 2 {
+		t.Errorf("expected --no-cache to assume the role, got %d requests", n)
+	}
+}
+
+func TestProcessCommandError(t *testing.T) {
+	server := ststest.NewServer()
+	defer server.Close()
+	server.Setenv(t, "arn:aws:iam::123456789012:role/gitlab-deployer")
+	cacheDir := t.TempDir()
+	t.Setenv("GITLAB_AWS_CACHE_DIR", cacheDir)
+	server.Enqueue(ststest.Response{ErrorCode: "AccessDenied", ErrorMessage: "Not authorized to perform sts:AssumeRoleWithWebIdentity"})
+
+	output, err := runProcess(t)
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("expected an AccessDenied error, got %v", err)
+	}
+	if output != "" {
+		t.Errorf("expected no output on error, got %s", output)
+	}
+	entries, _ := os.ReadDir(cacheDir)
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".json") {
+			t.Errorf("expected no cached credentials on error, found %s", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package profiles
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/awsprofile"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Cmd to write the credentials of multiple profiles to the AWS shared credentials file
+type Cmd struct {
+	cmd.RootCommand
+	Filename string
+	DryRun   bool
+}
+
+// NewCmd creates a command to write the credentials of all configured profiles to the AWS shared credentials file
+func NewCmd() *cobra.Command {
+	c := Cmd{
+		RootCommand: cmd.RootCommand{
+			Command: cobra.Command{
+				Use:   "aws-profiles",
+				Short: "stores the credentials of all configured profiles in the AWS shared credentials file",
+				Long: `
+Stores the credentials of all profiles listed in the configuration file in the AWS shared credentials
+file. The roles are assumed concurrently, and all profiles are written to the shared credentials file
+in a single update. If any of the roles cannot be assumed, no profile is written.
+
+The configuration file defaults to .gitlab-aws-profiles.yaml, but can be overridden through the
+environment variable GITLAB_AWS_PROFILES_FILE or the command line option --config/-c. The global
+flags supply the defaults for settings not specified by a profile.
+
+	profiles:
+	  default:
+		role-name: gitlab-deployer
+		region: eu-west-1
+	  production:
+		aws-account: "123456789012"
+		role-name: deployer
+		role-session-name: production-deployment
+		duration-seconds: 900
+		region: eu-central-1
+`,
+			},
+		},
+	}
+
+	c.AddPersistentFlags()
+	if c.Filename = os.Getenv("GITLAB_AWS_PROFILES_FILE"); c.Filename == "" {
+		c.Filename = ".gitlab-aws-profiles.yaml"
+	}
+	c.Flags().StringVarP(&c.Filename, "config", "c", c.Filename, "the profiles configuration file")
+	c.Flags().BoolVar(&c.DryRun, "dry-run", false, "show the changes to the credentials file as a diff, without writing it")
+
+	c.PersistentPreRunE = func(_ *cobra.Command, args []string) error {
+		return c.ValidateEnvironment()
+	}
+
+	c.RunE = func(_ *cobra.Command, args []string) error {
+		config, err := LoadConfig(c.Filename)
+		if err != nil {
+			return err
+		}
+		profiles, err := c.GetProfileCredentials(config)
+		if err != nil {
+			return err
+		}
+		return awsprofile.WriteToSharedConfig(c.DryRun, profiles...)
+	}
+
+	return &c.Command
+}
+
+// NewProfileCommand creates a root command for the profile, using the settings of c as defaults.
+func (c *Cmd) NewProfileCommand(profile ProfileConfig) *cmd.RootCommand {
+	result := &cmd.RootCommand{WebIdentityTokenName: c.WebIdentityTokenName}
+	result.Options = c.Options
+	result.RoleArn = ""
+	if profile.AwsAccount != "" {
+		result.AwsAccount = profile.AwsAccount
+	}
+	if profile.RoleName != "" {
+		result.RoleName = profile.RoleName
+	}
+	if profile.RoleArn != "" {
+		result.RoleArn = profile.RoleArn
+	}
+	if profile.RoleSessionName != "" {
+		result.RoleSessionName = profile.RoleSessionName
+	}
+	if profile.DurationSeconds != 0 {
+		result.DurationSeconds = profile.DurationSeconds
+	}
+	if profile.Region != "" {
+		result.Region = profile.Region
+	}
+	if profile.ChainRoles != nil {
+		result.RoleChainSpecs = profile.ChainRoles
+	}
+	return result
+}
+
+// GetProfileCredentials concurrently gets the STS credentials for all profiles in the configuration.
+func (c *Cmd) GetProfileCredentials(config *Config) ([]awsprofile.Profile, error) {
+	names := config.ProfileNames()
+	// a single token source, so that the token is read from stdin only once
+	if err := c.SetTokenSource(); err != nil {
+		return nil, err
+	}
+	var session *awssession.Session
+	if c.NewSTSClient == nil {
+		// a single session shared by all profiles, as sessions cannot be created concurrently
+		var err error
+		if session, err = awssession.NewSession(); err != nil {
+			return nil, errors.Errorf("failed to create an AWS session, %s", err)
+		}
+	}
+	profiles := make([]awsprofile.Profile, len(names))
+	failures := make([]string, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			profile := config.Profiles[name]
+			root := c.NewProfileCommand(profile)
+			if session != nil {
+				root.NewSTSClient = func(creds *credentials.Credentials) (stsiface.STSAPI, error) {
+					return root.STSEndpoint.NewClient(session, creds), nil
+				}
+			}
+			if err := root.GetSTSCredentials(); err != nil {
+				failures[i] = "profile " + name + ": " + err.Error()
+				return
+			}
+			profiles[i] = awsprofile.Profile{Name: name, Region: root.Region, Credentials: root.Credentials}
+		}(i, name)
+	}
+	wg.Wait()
+
+	var messages []string
+	for _, failure := range failures {
+		if failure != "" {
+			messages = append(messages, failure)
+		}
+	}
+	if len(messages) > 0 {
+		return nil, errors.Errorf("failed to get credentials for %d of %d profiles\n%s", len(messages), len(names), strings.Join(messages, "\n"))
+	}
+	return profiles, nil
+}
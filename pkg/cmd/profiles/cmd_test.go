@@ -0,0 +1,87 @@
+package profiles
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds/ststest"
+)
+
+const profilesConfig = `
+profiles:
+  default:
+    role-name: gitlab-deployer
+  staging:
+    aws-account: "210987654321"
+    role-name: deployer
+    region: eu-west-1
+  production:
+    role-arn: arn:aws:iam::111111111111:role/deployer
+    duration-seconds: 900
+`
+
+func setup(t *testing.T) (*ststest.Server, string) {
+	server := ststest.NewServer()
+	t.Cleanup(server.Close)
+	server.Setenv(t, "")
+	t.Setenv("GITLAB_AWS_ACCOUNT_ID", "123456789012")
+	t.Setenv("GITLAB_AWS_PROFILES_FILE", "")
+	filename := filepath.Join(t.TempDir(), "credentials")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filename)
+	return server, filename
+}
+
+func runAWSProfiles(args ...string) error {
+	command := NewCmd()
+	command.SetArgs(args)
+	command.SilenceUsage, command.SilenceErrors = true, true
+	return command.Execute()
+}
+
+func TestAWSProfilesCommand(t *testing.T) {
+	server, filename := setup(t)
+	if err := runAWSProfiles("--config", writeConfig(t, profilesConfig)); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"[default]\n", "[staging]\n", "[production]\n", "region = eu-west-1\n"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected %s in the credentials file, got\n%s", want, content)
+		}
+	}
+
+	roles := map[string]int64{}
+	for _, r := range server.Requests() {
+		roles[r.RoleArn] = r.DurationSeconds
+	}
+	want := map[string]int64{
+		"arn:aws:iam::123456789012:role/gitlab-deployer": 3600,
+		"arn:aws:iam::210987654321:role/deployer":        3600,
+		"arn:aws:iam::111111111111:role/deployer":        900,
+	}
+	if len(roles) != len(want) {
+		t.Errorf("expected the roles %v to be assumed, got %v", want, roles)
+	}
+	for arn, duration := range want {
+		if roles[arn] != duration {
+			t.Errorf("expected %s to be assumed for %d seconds, got %d", arn, duration, roles[arn])
+		}
+	}
+}
+
+func TestAWSProfilesCommandError(t *testing.T) {
+	_, filename := setup(t)
+	config := profilesConfig + "  invalid:\n    aws-account: \"12345\"\n    role-name: deployer\n"
+	err := runAWSProfiles("--config", writeConfig(t, config))
+	if err == nil || !strings.Contains(err.Error(), "failed to get credentials for 1 of 4 profiles") || !strings.Contains(err.Error(), "profile invalid:") {
+		t.Errorf("expected the invalid profile to fail, got %v", err)
+	}
+	if _, err = os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("expected no credentials to be written when a profile fails, got %v", err)
+	}
+}
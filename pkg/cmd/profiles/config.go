@@ -0,0 +1,63 @@
+package profiles
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ProfileConfig the configuration of a single profile.
+type ProfileConfig struct {
+	AwsAccount      string   `yaml:"aws-account"`
+	RoleName        string   `yaml:"role-name"`
+	RoleArn         string   `yaml:"role-arn"`
+	RoleSessionName string   `yaml:"role-session-name"`
+	DurationSeconds int64    `yaml:"duration-seconds"`
+	Region          string   `yaml:"region"`
+	ChainRoles      []string `yaml:"chain-roles"`
+}
+
+// Config the profiles configuration file.
+type Config struct {
+	Profiles map[string]ProfileConfig `yaml:"profiles"`
+}
+
+// LoadConfig reads the profiles configuration from the file.
+func LoadConfig(filename string) (*Config, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Errorf("failed to read profiles configuration %s, %s", filename, err)
+	}
+	var config Config
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&config); err != nil && err != io.EOF {
+		return nil, errors.Errorf("failed to parse profiles configuration %s, %s", filename, err)
+	}
+	if len(config.Profiles) == 0 {
+		return nil, errors.Errorf("no profiles found in %s", filename)
+	}
+	for name, profile := range config.Profiles {
+		if name == "" {
+			return nil, errors.Errorf("profile without a name in %s", filename)
+		}
+		if profile.DurationSeconds < 0 {
+			return nil, errors.Errorf("duration-seconds of profile %s is not a positive integer", name)
+		}
+	}
+	return &config, nil
+}
+
+// ProfileNames returns the names of the profiles in sorted order.
+func (c *Config) ProfileNames() []string {
+	result := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,82 @@
+package profiles
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	filename := filepath.Join(t.TempDir(), "profiles.yaml")
+	if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s, %s", filename, err)
+	}
+	return filename
+}
+
+func TestLoadConfig(t *testing.T) {
+	filename := writeConfig(t, `
+profiles:
+  production:
+    aws-account: "123456789012"
+    role-name: deployer
+    duration-seconds: 900
+    region: eu-central-1
+  default:
+    role-name: gitlab-deployer
+`)
+	config, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := config.ProfileNames(); !reflect.DeepEqual(names, []string{"default", "production"}) {
+		t.Errorf("ProfileNames() = %v, want [default production]", names)
+	}
+
+	want := ProfileConfig{AwsAccount: "123456789012", RoleName: "deployer", DurationSeconds: 900, Region: "eu-central-1"}
+	if got := config.Profiles["production"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("production profile = %v, want %v", got, want)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty file", "", "no profiles found"},
+		{"no profiles", "profiles: {}\n", "no profiles found"},
+		{"invalid yaml", "profiles: [\n", "failed to parse"},
+		{"negative duration", "profiles:\n  default:\n    duration-seconds: -1\n", "not a positive integer"},
+		{"misspelled key", "profiles:\n  default:\n    role_name: deployer\n", "field role_name not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadConfig(writeConfig(t, tt.content)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q for %s, got %v", tt.want, tt.name, err)
+			}
+		})
+	}
+}
+
+func TestNewProfileCommand(t *testing.T) {
+	c := Cmd{}
+	c.AwsAccount = "111111111111"
+	c.RoleName = "gitlab-project"
+	c.DurationSeconds = 3600
+	c.RoleChainSpecs = []string{"arn:aws:iam::111111111111:role/next"}
+
+	root := c.NewProfileCommand(ProfileConfig{RoleName: "deployer", DurationSeconds: 900, ChainRoles: []string{}})
+	if root.AwsAccount != "111111111111" || root.RoleName != "deployer" || root.DurationSeconds != 900 || len(root.RoleChainSpecs) != 0 {
+		t.Errorf("profile settings not applied to the defaults, got %s %s %d %v", root.AwsAccount, root.RoleName, root.DurationSeconds, root.RoleChainSpecs)
+	}
+
+	root = c.NewProfileCommand(ProfileConfig{})
+	if root.RoleName != "gitlab-project" || len(root.RoleChainSpecs) != 1 {
+		t.Errorf("defaults not applied, got %s %v", root.RoleName, root.RoleChainSpecs)
+	}
+}
@@ -1,34 +1,25 @@
 package cmd
 
 import (
-	"errors"
 	"fmt"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-
-	awssession "github.com/aws/aws-sdk-go/aws/session"
-	awssts "github.com/aws/aws-sdk-go/service/sts"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
-// RootCommand the root command with all the global flags
+// RootCommand the root command with all the global flags, configuring the credentials provider from the
+// environment and the command line.
 type RootCommand struct {
 	cobra.Command
-	RoleName             string
-	RoleSessionName      string
-	AwsAccount           string
-	DurationSeconds      int64
-	PipelineId           string
-	WebIdentityTokenName string
-	WebIdentityToken     string
-	STS                  *awssts.STS
-	RoleArn              string
-	Credentials          *awssts.Credentials
+	gitlabcreds.Provider
+	WebIdentityTokenName  string
+	WebIdentityTokenFile  string
+	WebIdentityTokenStdin bool
+	Config                *Config
 }
 
 // AddPersistentFlags adds all the persistent flags to the command
@@ -36,19 +27,90 @@ func (c *RootCommand) AddPersistentFlags() {
 	c.PersistentFlags().SortFlags = false
 	c.SetDefaults()
 	c.Flags().SortFlags = false
-	c.Flags().StringVarP(&c.AwsAccount, "aws-account", "A", c.AwsAccount, "AWS account id to assume to role in (default $GITLAB_AWS_ACCOUNT_ID)")
-	c.Flags().StringVarP(&c.RoleName, "role-name", "r", c.RoleName, "Name of the role to assume (default gitlab-$CI_PROJECT_PATH_SLUG)")
-	c.Flags().StringVarP(&c.RoleSessionName, "role-session-name", "n", "", "the role session name to use  (default <role name>-$CI_PIPELINE_ID)`")
-	c.Flags().StringVarP(&c.WebIdentityTokenName, "web-identity-token-name", "j", c.WebIdentityTokenName, "of the environment variable with the JWT id token (default GITLAB_AWS_IDENTITY_TOKEN)")
+	c.Flags().StringVarP(&c.AwsAccount, "aws-account", "A", c.AwsAccount, "AWS account id or alias to assume to role in (default $GITLAB_AWS_ACCOUNT_ID)")
+	c.Flags().StringVarP(&c.RoleName, "role-name", "r", c.RoleName, "Name or template of the role to assume (default $GITLAB_AWS_ROLE_NAME or gitlab-$CI_PROJECT_PATH_SLUG)")
+	c.Flags().StringVar(&c.RoleArn, "role-arn", c.RoleArn, "the arn of the role to assume, instead of the account and role name (default $GITLAB_AWS_ROLE_ARN)")
+	c.Flags().StringVar(&c.Partition, "partition", c.Partition, "the AWS partition of the role and STS endpoint (default $GITLAB_AWS_PARTITION or derived from the region)")
+	c.Flags().StringVarP(&c.RoleSessionName, "role-session-name", "n", c.RoleSessionName, "the role session name or template to use  (default $GITLAB_AWS_ROLE_SESSION_NAME or <role name>-$CI_PIPELINE_ID)`")
+	c.AddTokenSourceFlags()
 	c.Flags().Int64VarP(&c.DurationSeconds, "duration-seconds", "d", c.DurationSeconds, "of the session")
+	c.Flags().StringArrayVarP(&c.RoleChainSpecs, "chain-role", "C", c.RoleChainSpecs, "role to assume next, as <role arn>[,external-id=<id>][,session-name=<name>][,duration-seconds=<seconds>] (default $GITLAB_AWS_ROLE_CHAIN)")
+	c.Flags().IntVar(&c.Retry.MaxAttempts, "max-attempts", c.Retry.MaxAttempts, "maximum number of attempts to call STS on transient errors (default $GITLAB_AWS_MAX_ATTEMPTS)")
+	c.Flags().DurationVar(&c.Retry.Deadline, "retry-deadline", c.Retry.Deadline, "maximum total duration of the attempts to call STS (default $GITLAB_AWS_RETRY_DEADLINE)")
+	c.Flags().StringVar(&c.SessionPolicy.Policy, "policy", c.SessionPolicy.Policy, "inline JSON session policy to scope down the credentials (default $GITLAB_AWS_POLICY)")
+	c.Flags().StringVar(&c.SessionPolicy.PolicyFile, "policy-file", c.SessionPolicy.PolicyFile, "file with the JSON session policy to scope down the credentials (default $GITLAB_AWS_POLICY_FILE)")
+	c.Flags().StringArrayVar(&c.SessionPolicy.PolicyArns, "policy-arn", c.SessionPolicy.PolicyArns, "arn of a managed session policy to scope down the credentials (default $GITLAB_AWS_POLICY_ARNS)")
+	c.Flags().StringVar(&c.ExpectedAudience, "expected-audience", c.ExpectedAudience, "the audience the id token must have (default $GITLAB_AWS_EXPECTED_AUDIENCE)")
+	c.Flags().StringVar(&c.ExpectedIssuer, "expected-issuer", c.ExpectedIssuer, "the issuer the id token must have (default $GITLAB_AWS_EXPECTED_ISSUER or $CI_SERVER_URL)")
+	c.Flags().StringVar(&c.Region, "region", c.Region, "the region to pass on with the credentials, and of the STS endpoint if no STS region is specified (default $GITLAB_AWS_REGION)")
+	c.Flags().StringVar(&c.STSEndpoint.Region, "sts-region", c.STSEndpoint.Region, "the region of the STS endpoint (default $GITLAB_AWS_STS_REGION or $AWS_REGION)")
+	c.Flags().BoolVar(&c.STSEndpoint.Regional, "sts-regional-endpoint", c.STSEndpoint.Regional, "use the regional instead of the global STS endpoint (default $GITLAB_AWS_STS_REGIONAL_ENDPOINT)")
+	c.Flags().BoolVar(&c.STSEndpoint.UseFIPS, "use-fips-endpoint", c.STSEndpoint.UseFIPS, "use the FIPS STS endpoint (default $GITLAB_AWS_USE_FIPS_ENDPOINT)")
+	c.Flags().BoolVar(&c.STSEndpoint.UseDualStack, "use-dualstack-endpoint", c.STSEndpoint.UseDualStack, "use the dual-stack STS endpoint (default $GITLAB_AWS_USE_DUALSTACK_ENDPOINT)")
+	c.Flags().StringVar(&c.STSEndpoint.URL, "sts-endpoint-url", c.STSEndpoint.URL, "override the url of the STS endpoint (default $GITLAB_AWS_STS_ENDPOINT_URL)")
 	c.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
-		if _, err := GetDurationSecondsFromEnvironment(); err != nil {
+		if err := c.ValidateEnvironment(); err != nil {
 			return err
 		}
 		return c.GetSTSCredentials()
 	}
 }
 
+// AddTokenSourceFlags adds the flags selecting the source of the web identity token to the command.
+func (c *RootCommand) AddTokenSourceFlags() {
+	c.Flags().StringVarP(&c.WebIdentityTokenName, "web-identity-token-name", "j", c.WebIdentityTokenName, "of the environment variable with the JWT id token (default GITLAB_AWS_IDENTITY_TOKEN)")
+	c.Flags().StringVar(&c.WebIdentityTokenFile, "web-identity-token-file", c.WebIdentityTokenFile, "file with the JWT id token, read on every refresh (default $GITLAB_AWS_IDENTITY_TOKEN_FILE)")
+	c.Flags().BoolVar(&c.WebIdentityTokenStdin, "web-identity-token-stdin", false, "read the JWT id token from stdin")
+}
+
+// ValidateEnvironment returns an error if any of the environment variables supplying defaults is invalid, and
+// applies the rule selecting the role, unless the role is specified on the command line. An account which is
+// neither an account id nor an alias is reported before any call to STS.
+func (c *RootCommand) ValidateEnvironment() error {
+	if _, err := GetDurationSecondsFromEnvironment(); err != nil {
+		return err
+	}
+	if _, err := GetMaxAttemptsFromEnvironment(); err != nil {
+		return err
+	}
+	if _, err := GetRetryDeadlineFromEnvironment(); err != nil {
+		return err
+	}
+	if _, err := LoadConfig(); err != nil {
+		return err
+	}
+	if !c.Flags().Changed("role-name") && !c.Flags().Changed("role-arn") {
+		if err := c.SetTokenSource(); err != nil {
+			return err
+		}
+		rule, err := c.SelectRule(c.TokenSource)
+		if err != nil {
+			return err
+		}
+		if rule >= 0 {
+			c.ApplyRule(rule)
+		}
+	}
+	c.ApplySessionPolicyFlags()
+	if c.AwsAccount != "" {
+		if _, err := gitlabcreds.ResolveAccount(c.AwsAccount, c.Accounts); err != nil {
+			return err
+		}
+	}
+	return ValidateSTSEndpointEnvironment()
+}
+
+// ApplySessionPolicyFlags lets an inline session policy on the command line replace the policy file from the
+// environment, and vice versa. Both are only rejected if both are specified in the same place.
+func (c *RootCommand) ApplySessionPolicyFlags() {
+	policy, policyFile := c.Flags().Changed("policy"), c.Flags().Changed("policy-file")
+	if policy && !policyFile {
+		c.SessionPolicy.PolicyFile = ""
+	} else if policyFile && !policy {
+		c.SessionPolicy.Policy = ""
+	}
+}
+
 // GetDurationSecondsFromEnvironment returns the integer value from GITLAB_AWS_DURATION_SECONDS or the default 3600 if it does not exist.
 // an invalid integer value, return the default value and err set.
 func GetDurationSecondsFromEnvironment() (seconds int64, err error) {
@@ -66,95 +128,148 @@ func GetDurationSecondsFromEnvironment() (seconds int64, err error) {
 
 // SetDefaults sets the defaults for the root command.
 func (c *RootCommand) SetDefaults() {
+	c.Config, _ = LoadConfig()
+	c.Options = gitlabcreds.DefaultOptions()
+	c.Accounts = c.Config.Accounts
 	c.PipelineId = os.Getenv("CI_PIPELINE_ID")
+	c.ProjectPathSlug = os.Getenv("CI_PROJECT_PATH_SLUG")
 
-	if slug := os.Getenv("CI_PROJECT_PATH_SLUG"); slug != "" {
-		c.RoleName = fmt.Sprintf("gitlab-%.57s", slug)
+	if c.WebIdentityTokenName = os.Getenv("GITLAB_AWS_IDENTITY_TOKEN_NAME"); c.WebIdentityTokenName == "" {
+		if c.WebIdentityTokenName = c.Config.WebIdentityTokenName; c.WebIdentityTokenName == "" {
+			c.WebIdentityTokenName = gitlabcreds.DefaultTokenName
+		}
+	}
+	c.WebIdentityTokenFile = os.Getenv("GITLAB_AWS_IDENTITY_TOKEN_FILE")
+
+	if roleName := os.Getenv("GITLAB_AWS_ROLE_NAME"); roleName != "" {
+		c.RoleName = roleName
+	} else if c.Config.RoleName != "" {
+		c.RoleName = c.Config.RoleName
+	} else if c.ProjectPathSlug != "" {
+		c.RoleName = fmt.Sprintf("gitlab-%.57s", c.ProjectPathSlug)
+	}
+	c.RoleSessionName = os.Getenv("GITLAB_AWS_ROLE_SESSION_NAME")
+	c.RoleArn = os.Getenv("GITLAB_AWS_ROLE_ARN")
+	c.Partition = os.Getenv("GITLAB_AWS_PARTITION")
+	if c.Region = os.Getenv("GITLAB_AWS_REGION"); c.Region == "" {
+		c.Region = c.Config.Region
 	}
 
 	if accountId := os.Getenv("GITLAB_AWS_ACCOUNT_ID"); accountId != "" {
 		c.AwsAccount = accountId
+	} else {
+		c.AwsAccount = c.Config.AwsAccount
 	}
 
 	c.DurationSeconds, _ = GetDurationSecondsFromEnvironment()
+	if os.Getenv("GITLAB_AWS_DURATION_SECONDS") == "" && c.Config.DurationSeconds > 0 {
+		c.DurationSeconds = c.Config.DurationSeconds
+	}
 
-	if c.WebIdentityTokenName = os.Getenv("GITLAB_AWS_IDENTITY_TOKEN_NAME"); c.WebIdentityTokenName == "" {
-		c.WebIdentityTokenName = "GITLAB_AWS_IDENTITY_TOKEN"
+	c.ExpectedAudience = os.Getenv("GITLAB_AWS_EXPECTED_AUDIENCE")
+	if c.ExpectedIssuer = os.Getenv("GITLAB_AWS_EXPECTED_ISSUER"); c.ExpectedIssuer == "" {
+		c.ExpectedIssuer = os.Getenv("CI_SERVER_URL")
 	}
+
+	c.RoleChainSpecs = GetRoleChainFromEnvironment()
+	c.STSEndpoint = GetSTSEndpointFromEnvironment()
+	c.SessionPolicy = GetSessionPolicyFromEnvironment()
+	c.Retry = GetRetryPolicyFromEnvironment()
+	c.RefreshMargin, _ = GetRefreshMarginFromEnvironment()
 }
 
-func truncate(name string, maxLength int) string {
-	if len(name) < maxLength {
-		return name
-	}
-	return string([]rune(name)[0:maxLength])
+// Setting the effective value of a setting, and where it came from.
+type Setting struct {
+	Name   string
+	Value  string
+	Source string
 }
 
-// GenerateRoleSessionName generates a valid role session name based on the role name and pipeline id.
-func GenerateRoleSessionName(roleName, pipelineId string) string {
-	maxLength := 64
-	invalidCharacters := regexp.MustCompile(`[^=,.@A-Za-z0-9_]+`)
-	validRoleSessionName := strings.Trim(invalidCharacters.ReplaceAllString(roleName, "-"), "-")
-	if pipelineId == "" {
-		return truncate(validRoleSessionName, 64)
-	} else {
-		maxLength = 64 - len(pipelineId) - 1
-		if maxLength <= 0 {
-			return truncate(pipelineId, 64)
+// Settings returns the effective value of each setting which can be specified in the configuration file, and
+// its source, in order of precedence: the flag, the environment variable, the configuration file or the default.
+func (c *RootCommand) Settings() []Setting {
+	awsAccount := c.AwsAccount
+	if accountId, found := c.Accounts[awsAccount]; found {
+		awsAccount = fmt.Sprintf("%s (%s)", accountId, awsAccount)
+	}
+	settings := []struct{ name, env, value string }{
+		{"aws-account", "GITLAB_AWS_ACCOUNT_ID", awsAccount},
+		{"role-name", "GITLAB_AWS_ROLE_NAME", c.RoleName},
+		{"duration-seconds", "GITLAB_AWS_DURATION_SECONDS", strconv.FormatInt(c.DurationSeconds, 10)},
+		{"region", "GITLAB_AWS_REGION", c.Region},
+		{"web-identity-token-name", "GITLAB_AWS_IDENTITY_TOKEN_NAME", c.WebIdentityTokenName},
+	}
+	result := make([]Setting, 0, len(settings))
+	for _, s := range settings {
+		setting := Setting{Name: s.name, Value: s.value, Source: "default"}
+		if flag := c.Flags().Lookup(s.name); flag != nil && flag.Changed {
+			setting.Source = "flag --" + s.name
+		} else if os.Getenv(s.env) != "" {
+			setting.Source = "env $" + s.env
+		} else if source := c.Config.Sources[s.name]; source != "" {
+			setting.Source = source
 		}
-		validRoleSessionName = truncate(validRoleSessionName, maxLength)
+		result = append(result, setting)
 	}
-	return fmt.Sprintf("%s-%s", validRoleSessionName, pipelineId)
+	return result
 }
 
-// GetSTSCredentials gets the STS credentials based upon the gitlab pipeline id token.
-func (c *RootCommand) GetSTSCredentials() error {
-	if c.RoleName == "" {
-		return errors.New("the role name is not set. Perhaps the environment variable CI_PROJECT_PATH_SLUG is not present")
-	}
-	if len(c.RoleName) > 64 {
-		return errors.New("the role name exceeds the maximum of 64 characters allowed by AWS")
+// NewTokenSource returns the token source for the settings of the command. A token source flag on the command
+// line takes precedence over the defaults from the environment, in order of precedence: the token file, stdin,
+// the environment variable named by the web identity token name, falling back to the deprecated CI_JOB_JWT_V2.
+// Returns an error if more than one token source flag is specified.
+func (c *RootCommand) NewTokenSource() (gitlabcreds.TokenSource, error) {
+	flags := make([]string, 0, 3)
+	for _, name := range []string{"web-identity-token-file", "web-identity-token-stdin", "web-identity-token-name"} {
+		if c.Flags().Changed(name) {
+			flags = append(flags, "--"+name)
+		}
 	}
-	if c.AwsAccount == "" {
-		return errors.New("the AWS account is not set. Use --aws-account or set the environment variable GITLAB_AWS_ACCOUNT_ID")
+	if len(flags) > 1 {
+		return nil, errors.Errorf("specify only one of %s", strings.Join(flags, ", "))
 	}
 
-	c.RoleArn = fmt.Sprintf("arn:aws:iam::%s:role/%s", c.AwsAccount, c.RoleName)
-
-	if c.WebIdentityToken = os.Getenv(c.WebIdentityTokenName); c.WebIdentityToken == "" {
-		return errors.New(fmt.Sprintf("the environment variable %s is not set", c.WebIdentityTokenName))
+	switch {
+	case c.Flags().Changed("web-identity-token-name"):
+		return gitlabcreds.NewEnvTokenSourceWithFallback(c.WebIdentityTokenName), nil
+	case c.WebIdentityTokenStdin:
+		return &gitlabcreds.ReaderTokenSource{Reader: os.Stdin}, nil
+	case c.WebIdentityTokenFile != "":
+		return &gitlabcreds.FileTokenSource{Path: c.WebIdentityTokenFile}, nil
+	default:
+		return gitlabcreds.NewEnvTokenSourceWithFallback(c.WebIdentityTokenName), nil
 	}
+}
 
-	if c.RoleSessionName == "" {
-		c.RoleSessionName = GenerateRoleSessionName(c.RoleName, c.PipelineId)
+// SetTokenSource sets the token source of the command, if it is not set yet.
+func (c *RootCommand) SetTokenSource() (err error) {
+	if c.TokenSource == nil {
+		c.TokenSource, err = c.NewTokenSource()
 	}
+	return err
+}
 
-	var err error
-	var session *awssession.Session
-	session, err = awssession.NewSession(
-		&aws.Config{
-			Credentials: credentials.AnonymousCredentials,
-		},
-	)
-	if err != nil {
+// GetSTSCredentials gets the STS credentials based upon the gitlab pipeline id token.
+func (c *RootCommand) GetSTSCredentials() error {
+	if err := c.ResolveRole(); err != nil {
 		return err
 	}
+	return c.AssumeRole()
+}
 
-	c.STS = awssts.New(session)
-
-	input := &awssts.AssumeRoleWithWebIdentityInput{
-		RoleArn:          aws.String(c.RoleArn),
-		RoleSessionName:  aws.String(c.RoleSessionName),
-		WebIdentityToken: aws.String(c.WebIdentityToken),
-		DurationSeconds:  aws.Int64(c.DurationSeconds),
+// ReadWebIdentityToken reads the web identity token from the token source of the command and decodes it.
+func (c *RootCommand) ReadWebIdentityToken() error {
+	if err := c.SetTokenSource(); err != nil {
+		return err
 	}
+	return c.Provider.ReadWebIdentityToken()
+}
 
-	result, err := c.STS.AssumeRoleWithWebIdentity(input)
-	if err == nil {
-		c.Credentials = result.Credentials
-	} else {
+// ResolveRole validates the settings and determines the role arn, role session name and web identity token,
+// reading the token from the token source of the command.
+func (c *RootCommand) ResolveRole() error {
+	if err := c.SetTokenSource(); err != nil {
 		return err
 	}
-
-	return nil
+	return c.Provider.ResolveRole()
 }
@@ -2,7 +2,11 @@ package cmd
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds"
 )
 
 func mustSetenv(t *testing.T, name, value string) {
@@ -12,6 +16,7 @@ func mustSetenv(t *testing.T, name, value string) {
 }
 
 func TestSetDefaultsWithDefaults(t *testing.T) {
+	setupConfigFiles(t, "", "", "")
 	// Mock environment variables
 	mustSetenv(t, "CI_PIPELINE_ID", "12345")
 
@@ -52,6 +57,7 @@ func TestSetDefaultsWithDefaults(t *testing.T) {
 }
 
 func TestSetDefaultsWithEnvOverride(t *testing.T) {
+	setupConfigFiles(t, "", "", "")
 	// Mock environment variables
 	mustSetenv(t, "CI_PIPELINE_ID", "654321")
 
@@ -94,6 +100,7 @@ func TestSetDefaultsWithEnvOverride(t *testing.T) {
 }
 
 func TestSetDefaultsInvalidDuration(t *testing.T) {
+	setupConfigFiles(t, "", "", "")
 	// Mock environment variables
 	mustSetenv(t, "GITLAB_AWS_DURATION_SECONDS", "invalid_duration")
 	c := &RootCommand{}
@@ -103,35 +110,129 @@ func TestSetDefaultsInvalidDuration(t *testing.T) {
 	}
 }
 
-func TestGenerateRoleSessionName(t *testing.T) {
-	type args struct {
-		roleName   string
-		pipelineId string
-	}
-	tests := []struct {
-		name string
-		args args
-		want string
-	}{
-		{"no pipeline", args{"role", ""}, "role"},
-		{"role and pipeline", args{"role", "1234"}, "role-1234"},
-		{"no leading or trailing dash", args{"-role-", ""}, "role"},
-		{"invalid chars", args{"/gitlab/role", "1234"}, "gitlab-role-1234"},
-		{"multiple invalid chars", args{"/gitlab/role-%^$abc", "1234"}, "gitlab-role-abc-1234"},
-		{"all valid special chars", args{"foo=bar@binx.io_", "1234"}, "foo=bar@binx.io_-1234"},
-		{"keep dashes", args{"gitlab-role--nice", ""}, "gitlab-role-nice"},
-		{"truncated to 64 chars", args{"L9i3LA4rF2rtMhImJBdvsKiBEKeltlmz6VLeVMwalW6ZyWFgWtVYZxKQfKVMHK57", "232324"}, "L9i3LA4rF2rtMhImJBdvsKiBEKeltlmz6VLeVMwalW6ZyWFgWtVYZxKQf-232324"},
-		{"pipeline id longer than chars", args{"gitlab-role", "L9i3LA4rF2rtMhImJBdvsKiBEKeltlmz6VLeVMwalW6ZyWFgWtVYZxKQfKVMHK57AAA"}, "L9i3LA4rF2rtMhImJBdvsKiBEKeltlmz6VLeVMwalW6ZyWFgWtVYZxKQfKVMHK57"},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := GenerateRoleSessionName(tt.args.roleName, tt.args.pipelineId); got != tt.want {
-				t.Errorf("GenerateRoleSessionName() = %v, want %v", got, tt.want)
-			} else {
-				if len(got) > 64 {
-					t.Errorf("GenerateRoleSessionName() = %v is over 64 characters long (%d)", got, len(got))
-				}
-			}
-		})
+func TestNewTokenSource(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	mustSetenv(t, "GITLAB_AWS_IDENTITY_TOKEN", "env-token")
+	mustSetenv(t, gitlabcreds.DeprecatedTokenName, "deprecated-token")
+	defer mustSetenv(t, "GITLAB_AWS_IDENTITY_TOKEN", "")
+	defer mustSetenv(t, gitlabcreds.DeprecatedTokenName, "")
+
+	c := &RootCommand{WebIdentityTokenName: "GITLAB_AWS_IDENTITY_TOKEN", WebIdentityTokenFile: tokenFile}
+	source, err := c.NewTokenSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Token(); err == nil {
+		t.Errorf("expected an error reading a missing token file")
+	}
+	for _, token := range []string{"first-token", "second-token"} {
+		if err := os.WriteFile(tokenFile, []byte(token+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := source.Token(); err != nil || got != token {
+			t.Errorf("expected the token file to be read on every call, got %s, %v", got, err)
+		}
+	}
+
+	c.WebIdentityTokenFile = ""
+	if got, _ := mustNewTokenSource(t, c).Token(); got != "env-token" {
+		t.Errorf("expected env-token, got %s", got)
+	}
+
+	c.WebIdentityTokenName = "UNDEFINED_TOKEN_NAME"
+	if got, _ := mustNewTokenSource(t, c).Token(); got != "deprecated-token" {
+		t.Errorf("expected fallback to deprecated-token, got %s", got)
+	}
+
+	mustSetenv(t, gitlabcreds.DeprecatedTokenName, "")
+	if _, err := mustNewTokenSource(t, c).Token(); err == nil || !strings.Contains(err.Error(), "UNDEFINED_TOKEN_NAME is not set") {
+		t.Errorf("expected an error about the missing variable, got %v", err)
+	}
+}
+
+func mustNewTokenSource(t *testing.T, c *RootCommand) gitlabcreds.TokenSource {
+	t.Helper()
+	source, err := c.NewTokenSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func TestNewTokenSourceFlags(t *testing.T) {
+	setupConfigFiles(t, "", "", "")
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GITLAB_AWS_IDENTITY_TOKEN_FILE", tokenFile)
+	t.Setenv("OTHER_TOKEN", "other-token")
+
+	c := &RootCommand{}
+	c.SetDefaults()
+	c.AddTokenSourceFlags()
+	if got, _ := mustNewTokenSource(t, c).Token(); got != "file-token" {
+		t.Errorf("expected the token file from the environment, got %s", got)
+	}
+	if err := c.Flags().Set("web-identity-token-name", "OTHER_TOKEN"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := mustNewTokenSource(t, c).Token(); got != "other-token" {
+		t.Errorf("expected --web-identity-token-name to override $GITLAB_AWS_IDENTITY_TOKEN_FILE, got %s", got)
+	}
+
+	c = &RootCommand{}
+	c.SetDefaults()
+	c.AddTokenSourceFlags()
+	if err := c.Flags().Set("web-identity-token-stdin", "true"); err != nil {
+		t.Fatal(err)
+	}
+	if source, ok := mustNewTokenSource(t, c).(*gitlabcreds.ReaderTokenSource); !ok {
+		t.Errorf("expected --web-identity-token-stdin to override $GITLAB_AWS_IDENTITY_TOKEN_FILE, got %T", source)
+	}
+	if err := c.Flags().Set("web-identity-token-file", tokenFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.NewTokenSource(); err == nil || !strings.Contains(err.Error(), "specify only one of --web-identity-token-file, --web-identity-token-stdin") {
+		t.Errorf("expected an error for more than one token source flag, got %v", err)
+	}
+}
+
+func TestSessionPolicyFlagOverridesEnvironment(t *testing.T) {
+	setupConfigFiles(t, "", "", "")
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(policyFile, []byte(`{"Version": "2012-10-17"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GITLAB_AWS_POLICY_FILE", policyFile)
+
+	c := &RootCommand{}
+	c.AddPersistentFlags()
+	if err := c.Flags().Set("policy", `{"Statement": []}`); err != nil {
+		t.Fatal(err)
+	}
+	c.ApplySessionPolicyFlags()
+	if policy, err := c.SessionPolicy.Resolve(); err != nil || policy != `{"Statement":[]}` {
+		t.Errorf("expected --policy to replace $GITLAB_AWS_POLICY_FILE, got %s, %v", policy, err)
+	}
+
+	t.Setenv("GITLAB_AWS_POLICY_FILE", "")
+	t.Setenv("GITLAB_AWS_POLICY", `{"Statement": []}`)
+	c = &RootCommand{}
+	c.AddPersistentFlags()
+	if err := c.Flags().Set("policy-file", policyFile); err != nil {
+		t.Fatal(err)
+	}
+	c.ApplySessionPolicyFlags()
+	if policy, err := c.SessionPolicy.Resolve(); err != nil || policy != `{"Version":"2012-10-17"}` {
+		t.Errorf("expected --policy-file to replace $GITLAB_AWS_POLICY, got %s, %v", policy, err)
+	}
+
+	if err := c.Flags().Set("policy", `{"Statement": []}`); err != nil {
+		t.Fatal(err)
+	}
+	c.ApplySessionPolicyFlags()
+	if _, err := c.SessionPolicy.Resolve(); err == nil || !strings.Contains(err.Error(), "not both") {
+		t.Errorf("expected an error for --policy and --policy-file, got %v", err)
 	}
 }
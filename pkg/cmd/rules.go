@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds"
+	"github.com/pkg/errors"
+)
+
+// RuleCondition the regular expressions which must match the whole value of the predefined Gitlab variables
+// and claims of the id token, for the rule to apply. Empty expressions match any value.
+type RuleCondition struct {
+	Ref            string            `yaml:"ref"`
+	RefProtected   string            `yaml:"ref-protected"`
+	Environment    string            `yaml:"environment"`
+	PipelineSource string            `yaml:"pipeline-source"`
+	Claims         map[string]string `yaml:"claims"`
+}
+
+// Rule selects the account and role to assume, when its condition matches. The rules are not a security
+// boundary, as anyone who can push a branch can change them: the trust policy of the role must check the claims.
+type Rule struct {
+	If         RuleCondition `yaml:"if"`
+	AwsAccount string        `yaml:"aws-account"`
+	RoleName   string        `yaml:"role-name"`
+}
+
+// RuleVariables the predefined Gitlab variables matched by the rules, by the name of the condition.
+var RuleVariables = []struct{ Name, Variable string }{
+	{"ref", "CI_COMMIT_REF_NAME"},
+	{"ref-protected", "CI_COMMIT_REF_PROTECTED"},
+	{"environment", "CI_ENVIRONMENT_NAME"},
+	{"pipeline-source", "CI_PIPELINE_SOURCE"},
+}
+
+func (c *RuleCondition) expressions() map[string]string {
+	return map[string]string{
+		"ref":             c.Ref,
+		"ref-protected":   c.RefProtected,
+		"environment":     c.Environment,
+		"pipeline-source": c.PipelineSource,
+	}
+}
+
+func matchExpression(expression, value string) bool {
+	return regexp.MustCompile("^(?:" + expression + ")$").MatchString(value)
+}
+
+// Validate returns an error if the rule has no role name, or an invalid regular expression.
+func (r *Rule) Validate() error {
+	if r.RoleName == "" {
+		return errors.New("no role-name specified")
+	}
+	expressions := r.If.expressions()
+	for name, expression := range r.If.Claims {
+		expressions["claims."+name] = expression
+	}
+	for name, expression := range expressions {
+		if _, err := regexp.Compile("^(?:" + expression + ")$"); err != nil {
+			return errors.Errorf("invalid regular expression for %s, %s", name, err)
+		}
+	}
+	return nil
+}
+
+// Matches returns true if all expressions of the condition match the environment variables and claims. The
+// claims are only read if the condition refers to a claim.
+func (r *Rule) Matches(getenv func(string) string, claims func() (*gitlabcreds.Token, error)) (bool, error) {
+	expressions := r.If.expressions()
+	for _, v := range RuleVariables {
+		if expression := expressions[v.Name]; expression != "" && !matchExpression(expression, getenv(v.Variable)) {
+			return false, nil
+		}
+	}
+	if len(r.If.Claims) == 0 {
+		return true, nil
+	}
+	token, err := claims()
+	if err != nil {
+		return false, errors.Errorf("failed to read the id token to match the claims of the rules, %s", err)
+	}
+	for name, expression := range r.If.Claims {
+		if _, found := token.Claims[name]; !found || !matchExpression(expression, token.StringClaim(name)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// SelectRule returns the index of the first rule matching the environment variables and claims. Returns an
+// error listing the values matched, if no rule matches.
+func SelectRule(rules []Rule, getenv func(string) string, claims func() (*gitlabcreds.Token, error)) (int, error) {
+	for i := range rules {
+		matches, err := rules[i].Matches(getenv, claims)
+		if err != nil {
+			return -1, err
+		}
+		if matches {
+			return i, nil
+		}
+	}
+
+	values := make([]string, 0, len(RuleVariables))
+	for _, v := range RuleVariables {
+		values = append(values, fmt.Sprintf("%s=%q", v.Variable, getenv(v.Variable)))
+	}
+	sort.Strings(values)
+	return -1, errors.Errorf("none of the %d rules matches %s. Add a rule without a condition as fallback, or specify the role explicitly", len(rules), strings.Join(values, ", "))
+}
+
+// SelectRule returns the index of the rule selecting the account and role, or -1 if there are no rules or the
+// role is specified by the environment variable GITLAB_AWS_ROLE_NAME or GITLAB_AWS_ROLE_ARN. The claims are
+// read from the token source, if a rule refers to a claim.
+func (c *RootCommand) SelectRule(source gitlabcreds.TokenSource) (int, error) {
+	if c.Config == nil || len(c.Config.Rules) == 0 || os.Getenv("GITLAB_AWS_ROLE_NAME") != "" || os.Getenv("GITLAB_AWS_ROLE_ARN") != "" {
+		return -1, nil
+	}
+	claims := func() (*gitlabcreds.Token, error) {
+		token, err := source.Token()
+		if err != nil {
+			return nil, err
+		}
+		return gitlabcreds.ParseToken(token)
+	}
+	i, err := SelectRule(c.Config.Rules, os.Getenv, claims)
+	if err != nil {
+		return -1, errors.Errorf("%s, in %s", err, c.Config.Sources["rules"])
+	}
+	return i, nil
+}
+
+// ApplyRule sets the role name and account of the rule, unless the account is specified by the flag
+// --aws-account or the environment variable GITLAB_AWS_ACCOUNT_ID. The source of the settings is reported as the rule.
+func (c *RootCommand) ApplyRule(i int) {
+	source := fmt.Sprintf("rule %d in %s", i+1, c.Config.Sources["rules"])
+	rule := c.Config.Rules[i]
+	c.RoleName = rule.RoleName
+	c.Config.Sources["role-name"] = source
+	if rule.AwsAccount != "" && !c.Flags().Changed("aws-account") && os.Getenv("GITLAB_AWS_ACCOUNT_ID") == "" {
+		c.AwsAccount = rule.AwsAccount
+		c.Config.Sources["aws-account"] = source
+	}
+}
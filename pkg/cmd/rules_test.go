@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds/ststest"
+)
+
+const testRules = `rules:
+  - if:
+      ref-protected: "true"
+      ref: main|v\d+\.\d+\.\d+
+    aws-account: "111111111111"
+    role-name: deployer
+  - if:
+      claims:
+        namespace_path: platform
+    role-name: platform-reader
+  - if:
+      pipeline-source: merge_request_event|push
+    role-name: reader
+`
+
+func TestSelectRule(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		want      int
+		wantClaim bool
+	}{
+		{"protected branch", map[string]string{"CI_COMMIT_REF_NAME": "main", "CI_COMMIT_REF_PROTECTED": "true"}, 0, false},
+		{"protected tag", map[string]string{"CI_COMMIT_REF_NAME": "v1.2.3", "CI_COMMIT_REF_PROTECTED": "true"}, 0, false},
+		{"unprotected branch", map[string]string{"CI_COMMIT_REF_NAME": "main", "CI_COMMIT_REF_PROTECTED": "false", "CI_PIPELINE_SOURCE": "push"}, 2, true},
+		{"partial match", map[string]string{"CI_COMMIT_REF_NAME": "main-feature", "CI_COMMIT_REF_PROTECTED": "true", "CI_PIPELINE_SOURCE": "merge_request_event"}, 2, true},
+		{"no match", map[string]string{"CI_PIPELINE_SOURCE": "schedule"}, -1, true},
+	}
+	setupConfigFiles(t, "", "", testRules)
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claimsRead := false
+			claims := func() (*gitlabcreds.Token, error) {
+				claimsRead = true
+				return gitlabcreds.ParseToken(ststest.IdentityToken(map[string]interface{}{"namespace_path": "platform-team"}))
+			}
+			got, err := SelectRule(config.Rules, func(name string) string { return tt.env[name] }, claims)
+			if tt.want < 0 && (err == nil || !strings.Contains(err.Error(), `none of the 3 rules matches CI_COMMIT_REF_NAME="", CI_COMMIT_REF_PROTECTED="", CI_ENVIRONMENT_NAME="", CI_PIPELINE_SOURCE="schedule"`)) {
+				t.Errorf("expected no rule to match, got %v", err)
+			}
+			if tt.want >= 0 && err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || claimsRead != tt.wantClaim {
+				t.Errorf("expected rule %d, claims read %v, got %d, %v", tt.want, tt.wantClaim, got, claimsRead)
+			}
+		})
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	setupConfigFiles(t, "", "aws-account: \"222222222222\"\nrole-name: default\n", testRules)
+	t.Setenv("CI_COMMIT_REF_NAME", "main")
+	t.Setenv("CI_COMMIT_REF_PROTECTED", "true")
+
+	c := &RootCommand{}
+	c.AddPersistentFlags()
+	if c.AwsAccount != "222222222222" || c.RoleName != "default" {
+		t.Errorf("expected the rules to be applied after the flags are parsed, got %s in %s", c.RoleName, c.AwsAccount)
+	}
+	if err := c.ValidateEnvironment(); err != nil {
+		t.Fatal(err)
+	}
+	if c.AwsAccount != "111111111111" || c.RoleName != "deployer" {
+		t.Errorf("expected the deployer role in account 111111111111, got %s in %s", c.RoleName, c.AwsAccount)
+	}
+	for _, setting := range c.Settings()[:2] {
+		if !strings.HasPrefix(setting.Source, "rule 1 in repo file ") {
+			t.Errorf("expected %s from rule 1, got %s", setting.Name, setting.Source)
+		}
+	}
+
+	c = &RootCommand{}
+	c.AddPersistentFlags()
+	if err := c.Flags().Set("role-name", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ValidateEnvironment(); err != nil || c.RoleName != "other" || c.AwsAccount != "222222222222" {
+		t.Errorf("expected neither the role nor the account of a matching rule with --role-name, got %s in %s, %v", c.RoleName, c.AwsAccount, err)
+	}
+
+	t.Setenv("CI_COMMIT_REF_PROTECTED", "false")
+	t.Setenv("CI_PIPELINE_SOURCE", "schedule")
+	t.Setenv("GITLAB_AWS_IDENTITY_TOKEN", ststest.IdentityToken(nil))
+	c = &RootCommand{}
+	c.AddPersistentFlags()
+	if err := c.ValidateEnvironment(); err == nil || !strings.Contains(err.Error(), "none of the 3 rules matches") {
+		t.Errorf("expected no rule to match, got %v", err)
+	}
+	if err := c.Flags().Set("role-name", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ValidateEnvironment(); err != nil || c.RoleName != "admin" || c.AwsAccount != "222222222222" {
+		t.Errorf("expected the role on the command line to override the rules, got %s in %s, %v", c.RoleName, c.AwsAccount, err)
+	}
+
+	t.Setenv("GITLAB_AWS_ROLE_NAME", "ci")
+	c = &RootCommand{}
+	c.AddPersistentFlags()
+	if err := c.ValidateEnvironment(); err != nil || c.RoleName != "ci" {
+		t.Errorf("expected the role from the environment to override the rules, got %s, %v", c.RoleName, err)
+	}
+}
+
+func TestLoadConfigInvalidRules(t *testing.T) {
+	setupConfigFiles(t, "", "", "rules:\n  - if:\n      ref: main\n")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "rule 1 in") || !strings.Contains(err.Error(), "no role-name") {
+		t.Errorf("expected an error for a rule without a role, got %v", err)
+	}
+	setupConfigFiles(t, "", "", "rules:\n  - if:\n      claims:\n        ref_type: \"(tag\"\n    role-name: reader\n")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "invalid regular expression for claims.ref_type") {
+		t.Errorf("expected an error for an invalid expression, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package serve
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/env"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Cmd to serve the credentials through the container credentials endpoint.
+type Cmd struct {
+	cmd.RootCommand
+	Address  string
+	Filename string
+	Format   env.Format
+}
+
+// NewCmd creates a command to serve the credentials through the container credentials endpoint.
+func NewCmd() *cobra.Command {
+	c := Cmd{
+		RootCommand: cmd.RootCommand{
+			Command: cobra.Command{
+				Use:   "serve",
+				Short: "serves the credentials through a local container credentials endpoint",
+				Long: `
+Starts a local HTTP server implementing the ECS container credentials endpoint, and runs the command
+with the environment variables AWS_CONTAINER_CREDENTIALS_FULL_URI and AWS_CONTAINER_AUTHORIZATION_TOKEN
+instead of static credentials. The credentials are refreshed using the id token before they expire, so
+that commands running longer than the session duration keep on working.
+
+Without a command, the environment variables are written to the env file or stdout, and the server runs
+until it is terminated.
+
+The following gitlab-ci.yml snippets shows the usage of the serve command:
+
+	serve-demo:
+	  stage: build
+	  image:
+		name: public.ecr.aws/aws-cli/aws-cli:2.13.17
+		entrypoint: [""]
+	  id_tokens:
+		GITLAB_AWS_IDENTITY_TOKEN:
+		  aud: https://gitlab.com
+	  script:
+		- ./gitlab-aws-credential-helper serve -- ./long-running-deployment.sh
+	  needs:
+		- get-credential-helper
+`,
+			},
+		},
+	}
+
+	c.AddPersistentFlags()
+	if c.Address = os.Getenv("GITLAB_AWS_SERVE_ADDRESS"); c.Address == "" {
+		c.Address = "127.0.0.1:0"
+	}
+	c.Flags().StringVarP(&c.Address, "listen", "l", c.Address, "the address to listen on (default $GITLAB_AWS_SERVE_ADDRESS)")
+	c.Flags().StringVarP(&c.Filename, "filename", "f", "", "the name of the env file, when no command is specified")
+	c.Format.AddFlags(&c.Command)
+	c.Flags().DurationVarP(&c.RefreshMargin, "refresh-margin", "m", c.RefreshMargin, "refresh the credentials expiring within this margin (default $GITLAB_AWS_REFRESH_MARGIN)")
+
+	c.PreRunE = func(_ *cobra.Command, args []string) error {
+		if c.Filename != "" && len(args) > 0 {
+			return errors.New("either specify an output file or a command to execute")
+		}
+		if err := c.Format.Validate(); err != nil {
+			return err
+		}
+		_, err := cmd.GetRefreshMarginFromEnvironment()
+		return err
+	}
+
+	c.RunE = func(_ *cobra.Command, args []string) error {
+		token, err := NewAuthorizationToken()
+		if err != nil {
+			return err
+		}
+		server := &Server{
+			AuthorizationToken: token,
+			RoleArn:            c.RoleArns()[len(c.RoleArns())-1],
+			Credentials:        c.GetCredentials,
+		}
+		if err = server.Start(c.Address); err != nil {
+			return errors.Errorf("failed to listen on %s, %s", c.Address, err)
+		}
+		defer server.Close()
+
+		variables := []env.Variable{
+			{Name: "AWS_CONTAINER_CREDENTIALS_FULL_URI", Value: server.URL()},
+			{Name: "AWS_CONTAINER_AUTHORIZATION_TOKEN", Value: server.AuthorizationToken},
+		}
+		variables = append(variables, env.RegionVariables(c.Region)...)
+		if len(args) > 0 {
+			return RunProcess(&c.Command, args, NewEnvironment(os.Environ(), variables))
+		}
+
+		if err = env.WriteVariables(c.Filename, c.Format, variables); err != nil {
+			return err
+		}
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		return nil
+	}
+
+	return &c.Command
+}
+
+// ConflictingVariables the environment variables which take precedence over, or conflict with the container credentials.
+var ConflictingVariables = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+	"AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN",
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+}
+
+// NewEnvironment creates a new environment variable array without the conflicting variables, adding the variables.
+func NewEnvironment(environ []string, variables []env.Variable) []string {
+	conflicting := make(map[string]bool, len(ConflictingVariables)+len(variables))
+	for _, name := range ConflictingVariables {
+		conflicting[name] = true
+	}
+	for _, variable := range variables {
+		conflicting[variable.Name] = true
+	}
+
+	result := make([]string, 0, len(environ)+len(variables))
+	for _, entry := range environ {
+		if name, _, _ := strings.Cut(entry, "="); !conflicting[name] {
+			result = append(result, entry)
+		}
+	}
+	for _, variable := range variables {
+		result = append(result, variable.Name+"="+variable.Value)
+	}
+	return result
+}
+
+// ExitError the exit code of a command which failed, for the helper to exit with after the server is closed.
+type ExitError struct {
+	Program  string
+	ExitCode int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("%s exited with code %d", e.Program, e.ExitCode)
+}
+
+// RunProcess runs the command with the environment, forwarding the signals. If the command fails with an exit
+// code, an ExitError is returned and the error message and usage of the command c are silenced, as the command
+// has already reported its failure.
+func RunProcess(c *cobra.Command, args []string, environ []string) error {
+	program, err := exec.LookPath(args[0])
+	if err != nil {
+		return errors.Errorf("could not find program %s on path, %s", args[0], err)
+	}
+
+	child := exec.Command(program, args[1:]...)
+	child.Env = environ
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	if err = child.Start(); err != nil {
+		return errors.Errorf("could not start %s, %s", program, err)
+	}
+	go func() {
+		for s := range signals {
+			_ = child.Process.Signal(s)
+		}
+	}()
+
+	if err = child.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			c.SilenceErrors, c.SilenceUsage = true, true
+			return &ExitError{Program: program, ExitCode: exitErr.ExitCode()}
+		}
+		return errors.Errorf("%s failed, %s", program, err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package serve
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/env"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func TestNewEnvironment(t *testing.T) {
+	got := NewEnvironment(
+		[]string{"A=B", "AWS_ACCESS_KEY_ID=key", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI=/v2", "AWS_REGION=eu-west-1"},
+		[]env.Variable{{Name: "AWS_CONTAINER_CREDENTIALS_FULL_URI", Value: "http://127.0.0.1:1234/credentials"}},
+	)
+	want := []string{"A=B", "AWS_REGION=eu-west-1", "AWS_CONTAINER_CREDENTIALS_FULL_URI=http://127.0.0.1:1234/credentials"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewEnvironment() = %v, want %v", got, want)
+	}
+}
+
+func TestRunProcessExitCode(t *testing.T) {
+	c := &cobra.Command{}
+	if err := RunProcess(c, []string{"sh", "-c", "exit 0"}, os.Environ()); err != nil || c.SilenceErrors {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	err := RunProcess(c, []string{"sh", "-c", "exit 3"}, os.Environ())
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != 3 {
+		t.Fatalf("expected an exit error with exit code 3, got %v", err)
+	}
+	if !c.SilenceErrors || !c.SilenceUsage {
+		t.Errorf("expected the error message and usage to be silenced")
+	}
+}
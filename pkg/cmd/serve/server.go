@@ -0,0 +1,137 @@
+package serve
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awssts "github.com/aws/aws-sdk-go/service/sts"
+)
+
+// CredentialsPath the path on which the server returns the credentials.
+const CredentialsPath = "/credentials"
+
+// ContainerCredentials the response of the container credentials endpoint.
+type ContainerCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	Expiration      string
+	RoleArn         string `json:",omitempty"`
+}
+
+// CredentialsFunc returns valid credentials.
+type CredentialsFunc func() (*awssts.Credentials, error)
+
+// Server implements the ECS container credentials endpoint.
+type Server struct {
+	AuthorizationToken string
+	RoleArn            string
+	Credentials        CredentialsFunc
+	background         BackgroundServer
+}
+
+// BackgroundServer serves the requests of a handler on a local address in the background.
+type BackgroundServer struct {
+	// Name the name of the server in the log
+	Name     string
+	listener net.Listener
+	server   *http.Server
+}
+
+// Start listens on the address and serves the requests with the handler in the background.
+func (b *BackgroundServer) Start(address string, handler http.Handler) (err error) {
+	if b.listener, err = net.Listen("tcp", address); err != nil {
+		return err
+	}
+	b.server = &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := b.server.Serve(b.listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("ERROR: %s stopped, %s", b.Name, err)
+		}
+	}()
+	return nil
+}
+
+// URL returns the base url of the server.
+func (b *BackgroundServer) URL() string {
+	return "http://" + b.listener.Addr().String()
+}
+
+// Close stops the server.
+func (b *BackgroundServer) Close() error {
+	return b.server.Close()
+}
+
+// NewAuthorizationToken generates a random authorization token.
+func NewAuthorizationToken() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// ServeHTTP returns the credentials to requests with a valid authorization token.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != CredentialsPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(s.AuthorizationToken)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	credentials, err := s.Credentials()
+	if err != nil {
+		log.Printf("ERROR: failed to get credentials, %s", err)
+		http.Error(w, "failed to get credentials", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(ContainerCredentials{
+		AccessKeyId:     aws.StringValue(credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(credentials.SecretAccessKey),
+		Token:           aws.StringValue(credentials.SessionToken),
+		Expiration:      aws.TimeValue(credentials.Expiration).UTC().Format(time.RFC3339),
+		RoleArn:         s.RoleArn,
+	})
+	if err != nil {
+		log.Printf("WARNING: failed to write credentials response, %s", err)
+	}
+}
+
+// Start listens on the address and serves the requests in the background. Warns if the address is not a
+// loopback address, as the AWS SDKs reject an http container credentials url on any other address.
+func (s *Server) Start(address string) error {
+	s.background.Name = "credentials server"
+	if err := s.background.Start(address, s); err != nil {
+		return err
+	}
+	if ip := s.background.listener.Addr().(*net.TCPAddr).IP; !ip.IsLoopback() {
+		log.Printf("WARNING: %s is not a loopback address, the AWS SDKs reject the http url of the credentials server", ip)
+	}
+	return nil
+}
+
+// URL returns the full url of the credentials endpoint.
+func (s *Server) URL() string {
+	return s.background.URL() + CredentialsPath
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.background.Close()
+}
@@ -0,0 +1,86 @@
+package serve
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awssts "github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestServer(t *testing.T) {
+	expiration := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	server := &Server{
+		AuthorizationToken: "secret",
+		RoleArn:            "arn:aws:iam::123456789012:role/deployer",
+		Credentials: func() (*awssts.Credentials, error) {
+			return &awssts.Credentials{
+				AccessKeyId:     aws.String("key"),
+				SecretAccessKey: aws.String("secret"),
+				SessionToken:    aws.String("token"),
+				Expiration:      aws.Time(expiration),
+			}, nil
+		},
+	}
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		want          int
+	}{
+		{"valid", CredentialsPath, "secret", http.StatusOK},
+		{"no authorization", CredentialsPath, "", http.StatusUnauthorized},
+		{"invalid authorization", CredentialsPath, "guess", http.StatusUnauthorized},
+		{"unknown path", "/", "secret", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			request.Header.Set("Authorization", tt.authorization)
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			if response.Code != tt.want {
+				t.Fatalf("expected status %d, got %d", tt.want, response.Code)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var credentials ContainerCredentials
+			if err := json.Unmarshal(response.Body.Bytes(), &credentials); err != nil {
+				t.Fatal(err)
+			}
+			want := ContainerCredentials{"key", "secret", "token", "2023-11-14T22:13:20Z", "arn:aws:iam::123456789012:role/deployer"}
+			if credentials != want {
+				t.Errorf("expected %v, got %v", want, credentials)
+			}
+		})
+	}
+}
+
+func TestBackgroundServer(t *testing.T) {
+	server := BackgroundServer{Name: "test server"}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte(r.URL.Path)) })
+	if err := server.Start("127.0.0.1:0", handler); err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.Get(server.URL() + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if string(body) != "/ping" {
+		t.Errorf("expected the request to be handled, got %s", body)
+	}
+	if err = server.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = http.Get(server.URL() + "/ping"); err == nil {
+		t.Errorf("expected the server to be stopped")
+	}
+}
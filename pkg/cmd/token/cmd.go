@@ -0,0 +1,15 @@
+package token
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// NewCmd creates a command to group the id token subcommands
+func NewCmd() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "token",
+		Short: "commands to examine the Gitlab id token",
+	}
+	c.AddCommand(NewInspectCmd())
+	return c
+}
@@ -0,0 +1,136 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// InspectCmd to print the header and claims of the id token
+type InspectCmd struct {
+	cmd.RootCommand
+	Output string
+}
+
+// NewInspectCmd creates a command to print the header and claims of the id token
+func NewInspectCmd() *cobra.Command {
+	c := InspectCmd{
+		RootCommand: cmd.RootCommand{
+			Command: cobra.Command{
+				Use:   "inspect",
+				Short: "prints the header and claims of the id token",
+				Long: `
+Prints the header and claims of the id token, so that you can copy the exact values of claims like sub,
+project_path, ref_type, ref_protected, environment and namespace_path into the conditions of the trust
+policy of the IAM role. The signature of the token is never printed. The token is decoded locally, no
+network access is required.
+
+	inspect-token:
+	  stage: .pre
+	  id_tokens:
+		GITLAB_AWS_IDENTITY_TOKEN:
+		  aud: https://gitlab.com
+	  image:
+		name: ghcr.io/binxio/gitlab-aws-credential-helper:0.1.0
+		entrypoint: [""]
+	  script:
+		- gitlab-aws-credential-helper token inspect
+`,
+			},
+		},
+	}
+
+	c.SetDefaults()
+	c.Flags().SortFlags = false
+	c.AddTokenSourceFlags()
+	c.Flags().StringVarP(&c.Output, "output", "o", "table", "the output format, either table or json")
+
+	c.PreRunE = func(_ *cobra.Command, args []string) error {
+		if c.Output != "table" && c.Output != "json" {
+			return errors.Errorf("invalid output format %s, expected table or json", c.Output)
+		}
+		return nil
+	}
+
+	c.RunE = func(_ *cobra.Command, args []string) error {
+		if err := c.ReadWebIdentityToken(); err != nil {
+			return err
+		}
+		if c.Output == "json" {
+			return WriteJSON(os.Stdout, c.Token)
+		}
+		return WriteTable(os.Stdout, c.Token)
+	}
+
+	return &c.Command
+}
+
+// WriteJSON writes the header and claims of the token as a JSON object.
+func WriteJSON(w io.Writer, token *gitlabcreds.Token) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]interface{}{
+		"header": token.Header,
+		"claims": token.Claims,
+	})
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	result := make([]string, 0, len(values))
+	for key := range values {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(encoded)
+	}
+}
+
+// WriteTable writes the header and claims of the token as a table. The numeric date claims are
+// followed by their value in RFC3339 format.
+func WriteTable(w io.Writer, token *gitlabcreds.Token) error {
+	writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if _, err := fmt.Fprintln(writer, "SECTION\tNAME\tVALUE"); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(token.Header) {
+		if _, err := fmt.Fprintf(writer, "header\t%s\t%s\n", key, formatValue(token.Header[key])); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(token.Claims) {
+		value := formatValue(token.Claims[key])
+		switch key {
+		case "exp", "nbf", "iat", "auth_time":
+			if t, _, err := token.TimeClaim(key); err == nil {
+				value = fmt.Sprintf("%s (%s)", value, t.UTC().Format(time.RFC3339))
+			}
+		}
+		if _, err := fmt.Fprintf(writer, "claims\t%s\t%s\n", key, value); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
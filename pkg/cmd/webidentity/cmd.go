@@ -0,0 +1,133 @@
+package webidentity
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/awsconfig"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/cmd/env"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Cmd to configure the AWS library to assume the role with the id token itself.
+type Cmd struct {
+	cmd.RootCommand
+	TokenFile  string
+	AWSProfile string
+	Filename   string
+	Format     env.Format
+}
+
+// NewCmd creates a command to configure the AWS library to assume the role with the id token itself.
+func NewCmd() *cobra.Command {
+	c := Cmd{
+		RootCommand: cmd.RootCommand{
+			Command: cobra.Command{
+				Use:   "web-identity",
+				Short: "configures the AWS library to assume the role with the id token itself",
+				Long: `
+Writes the id token to a file readable only by the owner, and returns the environment variables
+AWS_ROLE_ARN, AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_SESSION_NAME. With these variables, the AWS
+library assumes the role with the id token itself, and refreshes the credentials when they expire.
+STS is not called by this command.
+
+When a profile name is specified with --profile/-p, the keys role_arn, web_identity_token_file and
+role_session_name are written to the profile in the AWS config file instead.
+
+The token file defaults to $CI_PROJECT_DIR/.gitlab-aws-credential-helper/web-identity-token. Role chaining
+and session policies are not supported in this mode.
+
+	web-identity-demo:
+	  stage: build
+	  image:
+		name: public.ecr.aws/aws-cli/aws-cli:2.13.17
+		entrypoint: [""]
+	  id_tokens:
+		GITLAB_AWS_IDENTITY_TOKEN:
+		  aud: https://gitlab.com
+	  script:
+		- ./gitlab-aws-credential-helper web-identity --profile default
+		- aws sts get-caller-identity
+	  needs:
+		- get-credential-helper
+`,
+			},
+		},
+	}
+
+	c.AddPersistentFlags()
+	c.TokenFile = DefaultTokenFile()
+	c.Flags().StringVarP(&c.TokenFile, "token-file", "t", c.TokenFile, "the file to write the id token to (default $GITLAB_AWS_WEB_IDENTITY_TOKEN_FILE)")
+	c.Flags().StringVarP(&c.AWSProfile, "profile", "p", "", "the name of the AWS profile to write, instead of environment variables")
+	c.Flags().StringVarP(&c.Filename, "filename", "f", "", "the name of the env file")
+	c.Format.AddFlags(&c.Command)
+
+	c.PersistentPreRunE = func(_ *cobra.Command, args []string) error {
+		if err := c.ValidateEnvironment(); err != nil {
+			return err
+		}
+		if err := c.ResolveRole(); err != nil {
+			return err
+		}
+		if len(c.RoleChain) > 0 {
+			return errors.New("role chaining is not supported in web identity mode")
+		}
+		if !c.SessionPolicy.IsEmpty() {
+			return errors.New("session policies are not supported in web identity mode")
+		}
+		if c.AWSProfile != "" && c.Filename != "" {
+			return errors.New("either specify a profile or an env file")
+		}
+		return c.Format.Validate()
+	}
+
+	c.RunE = func(_ *cobra.Command, args []string) (err error) {
+		if c.TokenFile, err = filepath.Abs(c.TokenFile); err != nil {
+			return err
+		}
+		if err = WriteTokenFile(c.TokenFile, c.WebIdentityToken); err != nil {
+			return err
+		}
+		if c.AWSProfile != "" {
+			profile := awsconfig.Profile{
+				Name: c.AWSProfile,
+				Values: map[string]string{
+					"role_arn":                c.RoleArn,
+					"web_identity_token_file": c.TokenFile,
+					"role_session_name":       c.RoleSessionName,
+				},
+			}
+			if c.Region != "" {
+				profile.Values["region"] = c.Region
+			}
+			return awsconfig.WriteToConfig(false, profile)
+		}
+		variables := []env.Variable{
+			{Name: "AWS_ROLE_ARN", Value: c.RoleArn},
+			{Name: "AWS_WEB_IDENTITY_TOKEN_FILE", Value: c.TokenFile},
+			{Name: "AWS_ROLE_SESSION_NAME", Value: c.RoleSessionName},
+		}
+		return env.WriteVariables(c.Filename, c.Format, append(variables, env.RegionVariables(c.Region)...))
+	}
+
+	return &c.Command
+}
+
+// DefaultTokenFile returns the token file from GITLAB_AWS_WEB_IDENTITY_TOKEN_FILE. If not set, it returns
+// a file in the job workspace $CI_PROJECT_DIR, or in the current directory outside of a job.
+func DefaultTokenFile() string {
+	if filename := os.Getenv("GITLAB_AWS_WEB_IDENTITY_TOKEN_FILE"); filename != "" {
+		return filename
+	}
+	return filepath.Join(os.Getenv("CI_PROJECT_DIR"), ".gitlab-aws-credential-helper", "web-identity-token")
+}
+
+// WriteTokenFile writes the token to the file, readable only by the owner.
+func WriteTokenFile(filename, token string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o700); err != nil {
+		return errors.Errorf("failed to create directory for %s, %s", filename, err)
+	}
+	return cmd.WriteFileAtomicMode(filename, []byte(token), 0o600)
+}
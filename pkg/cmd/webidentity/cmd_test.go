@@ -0,0 +1,70 @@
+package webidentity
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds/ststest"
+)
+
+func TestWriteTokenFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), ".gitlab-aws-credential-helper", "web-identity-token")
+	for _, token := range []string{"first.token.value", "second.token.value"} {
+		if err := WriteTokenFile(filename, token); err != nil {
+			t.Fatal(err)
+		}
+		// the token file stays readable only by the owner, even if its permissions were widened
+		if err := os.Chmod(filename, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != token {
+			t.Errorf("expected %s in token file, got %s", token, content)
+		}
+	}
+
+	if err := WriteTokenFile(filename, "third.token.value"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected token file mode 0600, got %o", info.Mode().Perm())
+	}
+}
+
+func TestWebIdentityCommandFormat(t *testing.T) {
+	server := ststest.NewServer()
+	t.Cleanup(server.Close)
+	server.Setenv(t, "arn:aws:iam::123456789012:role/gitlab-deployer")
+	directory := t.TempDir()
+	filename := filepath.Join(directory, "variables.json")
+
+	command := NewCmd()
+	command.SetArgs([]string{"--token-file", filepath.Join(directory, "token"), "--filename", filename, "--format", "json"})
+	command.SilenceUsage, command.SilenceErrors = true, true
+	if err := command.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var variables map[string]string
+	if err = json.Unmarshal(content, &variables); err != nil {
+		t.Fatalf("expected the variables as json, got %s", content)
+	}
+	if variables["AWS_ROLE_ARN"] != "arn:aws:iam::123456789012:role/gitlab-deployer" || variables["AWS_ROLE_SESSION_NAME"] != "gitlab-deployer-1234" {
+		t.Errorf("unexpected variables %v", variables)
+	}
+	if len(server.Requests()) != 0 {
+		t.Errorf("expected no calls to STS in web identity mode")
+	}
+}
@@ -0,0 +1,144 @@
+package gitlabcreds
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/pkg/errors"
+)
+
+var (
+	accountIdPattern = regexp.MustCompile(`^[0-9]{12}$`)
+	numberPattern    = regexp.MustCompile(`^[0-9]+$`)
+	roleNamePattern  = regexp.MustCompile(`^[\w+=,.@-]{1,64}$`)
+	rolePathPattern  = regexp.MustCompile(`^/([\x21-\x7E]*/)?$`)
+	roleArnPattern   = regexp.MustCompile(`^arn:([^:]+):iam::([^:]*):role(/.*)$`)
+)
+
+// DefaultRegions the region of the STS endpoint used for a partition, when no region is specified.
+var DefaultRegions = map[string]string{
+	"aws":        "us-east-1",
+	"aws-cn":     "cn-north-1",
+	"aws-us-gov": "us-gov-west-1",
+	"aws-iso":    "us-iso-east-1",
+	"aws-iso-b":  "us-isob-east-1",
+}
+
+// RoleArn the components of an IAM role arn.
+type RoleArn struct {
+	Partition string
+	AccountId string
+	Path      string
+	Name      string
+}
+
+// String returns the role arn.
+func (a RoleArn) String() string {
+	return fmt.Sprintf("arn:%s:iam::%s:role%s%s", a.Partition, a.AccountId, a.Path, a.Name)
+}
+
+// ValidateAccountId returns an error if the account id is not exactly 12 digits.
+func ValidateAccountId(accountId string) error {
+	if !accountIdPattern.MatchString(accountId) {
+		return errors.Errorf("the AWS account id '%s' is not a 12 digit number", accountId)
+	}
+	return nil
+}
+
+// IsAccountAlias returns true if the name is not a number, and may be used as the alias of an account.
+func IsAccountAlias(name string) bool {
+	return name != "" && !numberPattern.MatchString(name)
+}
+
+// ResolveAccount returns the account id of the alias, or the account if it is a valid account id. Returns
+// an error listing the known aliases, if the account is neither.
+func ResolveAccount(account string, aliases map[string]string) (string, error) {
+	if accountId, found := aliases[account]; found {
+		if err := ValidateAccountId(accountId); err != nil {
+			return "", errors.Errorf("invalid account id for alias %s, %s", account, err)
+		}
+		return accountId, nil
+	}
+	if !IsAccountAlias(account) {
+		return account, ValidateAccountId(account)
+	}
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return "", errors.Errorf("the AWS account '%s' is not a 12 digit number, and no account aliases are defined", account)
+	}
+	return "", errors.Errorf("the AWS account '%s' is not a 12 digit number or one of the account aliases %s", account, strings.Join(names, ", "))
+}
+
+// ValidatePartition returns an error if the partition is not a known AWS partition.
+func ValidatePartition(partition string) error {
+	if _, ok := DefaultRegions[partition]; ok {
+		return nil
+	}
+	for _, p := range endpoints.DefaultPartitions() {
+		if p.ID() == partition {
+			return nil
+		}
+	}
+	return errors.Errorf("'%s' is not a known AWS partition", partition)
+}
+
+// PartitionForRegion returns the partition of the region. found is false if the region is unknown.
+func PartitionForRegion(region string) (partition string, found bool) {
+	if p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		return p.ID(), true
+	}
+	return "", false
+}
+
+// SplitRolePath splits a role name in the form [path/]name into the IAM path and the role name.
+func SplitRolePath(roleName string) (path, name string) {
+	if i := strings.LastIndex(roleName, "/"); i >= 0 {
+		path = roleName[:i+1]
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		return path, roleName[i+1:]
+	}
+	return "/", roleName
+}
+
+// Validate returns an error if any of the components of the role arn is not well-formed.
+func (a RoleArn) Validate() error {
+	if err := ValidatePartition(a.Partition); err != nil {
+		return err
+	}
+	if err := ValidateAccountId(a.AccountId); err != nil {
+		return err
+	}
+	if len(a.Path) > 512 || !rolePathPattern.MatchString(a.Path) {
+		return errors.Errorf("the role path '%s' is not valid, it must begin and end with a slash", a.Path)
+	}
+	if len(a.Name) > 64 {
+		return errors.New("the role name exceeds the maximum of 64 characters allowed by AWS")
+	}
+	if !roleNamePattern.MatchString(a.Name) {
+		return errors.Errorf("the role name '%s' contains characters not allowed by AWS", a.Name)
+	}
+	return nil
+}
+
+// ParseRoleArn parses and validates the IAM role arn.
+func ParseRoleArn(arn string) (result RoleArn, err error) {
+	match := roleArnPattern.FindStringSubmatch(arn)
+	if match == nil {
+		return result, errors.Errorf("'%s' is not an IAM role arn", arn)
+	}
+	result.Partition, result.AccountId = match[1], match[2]
+	result.Path, result.Name = SplitRolePath(match[3][1:])
+	if err = result.Validate(); err != nil {
+		return result, errors.Errorf("invalid role arn '%s', %s", arn, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,103 @@
+package gitlabcreds
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRoleArn(t *testing.T) {
+	tests := []struct {
+		name    string
+		arn     string
+		want    RoleArn
+		wantErr bool
+	}{
+		{"commercial", "arn:aws:iam::123456789012:role/deployer", RoleArn{"aws", "123456789012", "/", "deployer"}, false},
+		{"govcloud with path", "arn:aws-us-gov:iam::123456789012:role/ci/gitlab/deployer", RoleArn{"aws-us-gov", "123456789012", "/ci/gitlab/", "deployer"}, false},
+		{"china", "arn:aws-cn:iam::123456789012:role/deployer", RoleArn{"aws-cn", "123456789012", "/", "deployer"}, false},
+		{"unknown partition", "arn:aws-mars:iam::123456789012:role/deployer", RoleArn{}, true},
+		{"short account id", "arn:aws:iam::12345678901:role/deployer", RoleArn{}, true},
+		{"not a role", "arn:aws:iam::123456789012:user/deployer", RoleArn{}, true},
+		{"invalid role name", "arn:aws:iam::123456789012:role/deploy%er", RoleArn{}, true},
+		{"no role name", "arn:aws:iam::123456789012:role/ci/", RoleArn{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRoleArn(tt.arn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRoleArn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				if got != tt.want {
+					t.Errorf("ParseRoleArn() = %v, want %v", got, tt.want)
+				}
+				if got.String() != tt.arn {
+					t.Errorf("String() = %s, want %s", got.String(), tt.arn)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveAccount(t *testing.T) {
+	aliases := map[string]string{"prod": "123456789012", "staging": "210987654321"}
+	tests := []struct {
+		name    string
+		account string
+		want    string
+		wantErr string
+	}{
+		{"alias", "prod", "123456789012", ""},
+		{"account id", "111111111111", "111111111111", ""},
+		{"short account id", "12345678901", "", "is not a 12 digit number"},
+		{"long account id", "1234567890123", "", "is not a 12 digit number"},
+		{"unknown alias", "prdo", "", "is not a 12 digit number or one of the account aliases prod, staging"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveAccount(tt.account, aliases)
+			if tt.wantErr == "" && (err != nil || got != tt.want) {
+				t.Errorf("ResolveAccount() = %s, %v, want %s", got, err, tt.want)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("ResolveAccount() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := ResolveAccount("prod", nil); err == nil || !strings.Contains(err.Error(), "no account aliases are defined") {
+		t.Errorf("expected an error without aliases, got %v", err)
+	}
+}
+
+func TestResolvePartition(t *testing.T) {
+	tests := []struct {
+		name          string
+		partition     string
+		region        string
+		arnPartition  string
+		wantPartition string
+		wantRegion    string
+		wantErr       bool
+	}{
+		{"defaults", "", "", "", "aws", "", false},
+		{"from region", "", "cn-northwest-1", "", "aws-cn", "cn-northwest-1", false},
+		{"from role arn", "", "", "aws-us-gov", "aws-us-gov", "us-gov-west-1", false},
+		{"explicit", "aws-cn", "", "", "aws-cn", "cn-north-1", false},
+		{"region outside partition", "aws-cn", "eu-west-1", "", "", "", true},
+		{"role arn outside partition", "aws", "", "aws-cn", "", "", true},
+		{"unknown partition", "aws-mars", "", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Provider{Options: Options{Partition: tt.partition}}
+			c.STSEndpoint.Region = tt.region
+			err := c.ResolvePartition(tt.arnPartition)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolvePartition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (c.Partition != tt.wantPartition || c.STSEndpoint.Region != tt.wantRegion) {
+				t.Errorf("ResolvePartition() = %s, %s, want %s, %s", c.Partition, c.STSEndpoint.Region, tt.wantPartition, tt.wantRegion)
+			}
+		})
+	}
+}
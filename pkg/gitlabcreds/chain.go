@@ -0,0 +1,119 @@
+package gitlabcreds
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	awssts "github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+// RoleChainHop is a role assumed with the credentials of the previous role in the chain.
+type RoleChainHop struct {
+	RoleArn         string
+	ExternalId      string
+	RoleSessionName string
+	DurationSeconds int64
+}
+
+// ParseRoleChainHop parses a hop specification of the form <role arn>[,external-id=<id>][,session-name=<name>][,duration-seconds=<seconds>].
+func ParseRoleChainHop(spec string) (hop RoleChainHop, err error) {
+	parts := strings.Split(spec, ",")
+	hop.RoleArn = strings.TrimSpace(parts[0])
+	if _, err = ParseRoleArn(hop.RoleArn); err != nil {
+		return hop, errors.Errorf("invalid role chain hop '%s', %s", spec, err)
+	}
+	for _, part := range parts[1:] {
+		name, value, found := strings.Cut(part, "=")
+		if !found {
+			return hop, errors.Errorf("invalid role chain hop '%s', expected name=value, got '%s'", spec, part)
+		}
+		switch strings.TrimSpace(name) {
+		case "external-id":
+			hop.ExternalId = value
+		case "session-name":
+			hop.RoleSessionName = value
+		case "duration-seconds":
+			if hop.DurationSeconds, err = strconv.ParseInt(value, 10, 64); err != nil || hop.DurationSeconds <= 0 {
+				return hop, errors.Errorf("invalid role chain hop '%s', duration-seconds is not a positive integer", spec)
+			}
+		default:
+			return hop, errors.Errorf("invalid role chain hop '%s', unknown attribute '%s'", spec, name)
+		}
+	}
+	return hop, nil
+}
+
+// ParseRoleChain parses the list of hop specifications into a role chain.
+func ParseRoleChain(specs []string) (chain []RoleChainHop, err error) {
+	chain = make([]RoleChainHop, 0, len(specs))
+	for _, spec := range specs {
+		var hop RoleChainHop
+		if hop, err = ParseRoleChainHop(spec); err != nil {
+			return nil, err
+		}
+		chain = append(chain, hop)
+	}
+	return chain, nil
+}
+
+// RoleArns returns the arn of the web identity role, followed by the arns of the role chain.
+func (p *Provider) RoleArns() []string {
+	result := make([]string, 0, len(p.RoleChain)+1)
+	result = append(result, p.RoleArn)
+	for _, hop := range p.RoleChain {
+		result = append(result, hop.RoleArn)
+	}
+	return result
+}
+
+// AssumeRoleChain assumes each role in the chain with the credentials of the previous hop, and
+// replaces the credentials with those of the final hop.
+func (p *Provider) AssumeRoleChain() error {
+	for i, hop := range p.RoleChain {
+		stsClient, err := p.newSTSClient(
+			credentials.NewStaticCredentials(
+				aws.StringValue(p.Credentials.AccessKeyId),
+				aws.StringValue(p.Credentials.SecretAccessKey),
+				aws.StringValue(p.Credentials.SessionToken)))
+		if err != nil {
+			return err
+		}
+
+		input := &awssts.AssumeRoleInput{
+			RoleArn:         aws.String(hop.RoleArn),
+			RoleSessionName: aws.String(hop.RoleSessionName),
+			DurationSeconds: aws.Int64(hop.DurationSeconds),
+		}
+		if hop.RoleSessionName == "" {
+			input.RoleSessionName = aws.String(p.RoleSessionName)
+		}
+		if hop.DurationSeconds == 0 {
+			// role chaining limits the session duration to a maximum of one hour
+			input.DurationSeconds = aws.Int64(p.DurationSeconds)
+			if p.DurationSeconds > 3600 {
+				input.DurationSeconds = aws.Int64(3600)
+			}
+		}
+		if hop.ExternalId != "" {
+			input.ExternalId = aws.String(hop.ExternalId)
+		}
+		if i == len(p.RoleChain)-1 {
+			input.Policy, input.PolicyArns = p.sessionPolicyInput()
+		}
+
+		var result *awssts.AssumeRoleOutput
+		err = p.Retry.Do("AssumeRole", func(ctx context.Context) (err error) {
+			result, err = stsClient.AssumeRoleWithContext(ctx, input)
+			return err
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to assume role %s in hop %d of the role chain", hop.RoleArn, i+1)
+		}
+		p.Credentials = result.Credentials
+	}
+	return nil
+}
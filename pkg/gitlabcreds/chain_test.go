@@ -0,0 +1,38 @@
+package gitlabcreds
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRoleChainHop(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    RoleChainHop
+		wantErr bool
+	}{
+		{"role arn only", "arn:aws:iam::123456789012:role/deployer", RoleChainHop{RoleArn: "arn:aws:iam::123456789012:role/deployer"}, false},
+		{
+			"all attributes",
+			"arn:aws:iam::123456789012:role/deployer,external-id=x=y,session-name=deploy,duration-seconds=900",
+			RoleChainHop{RoleArn: "arn:aws:iam::123456789012:role/deployer", ExternalId: "x=y", RoleSessionName: "deploy", DurationSeconds: 900},
+			false,
+		},
+		{"no role arn", "deployer", RoleChainHop{}, true},
+		{"no value", "arn:aws:iam::123456789012:role/deployer,external-id", RoleChainHop{}, true},
+		{"unknown attribute", "arn:aws:iam::123456789012:role/deployer,region=eu-west-1", RoleChainHop{}, true},
+		{"invalid duration", "arn:aws:iam::123456789012:role/deployer,duration-seconds=-1", RoleChainHop{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRoleChainHop(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRoleChainHop() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRoleChainHop() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
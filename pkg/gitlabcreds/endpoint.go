@@ -0,0 +1,72 @@
+package gitlabcreds
+
+import (
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	awssts "github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/pkg/errors"
+)
+
+// STSEndpoint the settings determining the STS endpoint to call.
+type STSEndpoint struct {
+	Region       string
+	URL          string
+	Regional     bool
+	UseFIPS      bool
+	UseDualStack bool
+}
+
+// Validate checks whether the settings are consistent.
+func (e *STSEndpoint) Validate() error {
+	if e.Regional && e.Region == "" {
+		return errors.New("a regional STS endpoint requires the region to be set. Use --sts-region or set the environment variable GITLAB_AWS_STS_REGION")
+	}
+	if e.URL != "" {
+		u, err := url.Parse(e.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errors.Errorf("the STS endpoint url %s is not a valid http(s) url", e.URL)
+		}
+	}
+	return nil
+}
+
+// NewSession creates an AWS session for calling STS with the specified credentials.
+func (e *STSEndpoint) NewSession(creds *credentials.Credentials) (*awssession.Session, error) {
+	return awssession.NewSession(e.Config(creds))
+}
+
+// NewClient creates an STS client for the endpoint calling with the specified credentials, on a shared
+// session. Unlike creating sessions, this is safe for concurrent use.
+func (e *STSEndpoint) NewClient(session *awssession.Session, creds *credentials.Credentials) stsiface.STSAPI {
+	return awssts.New(session, e.Config(creds))
+}
+
+// Config returns the AWS configuration for calling STS with the specified credentials.
+func (e *STSEndpoint) Config(creds *credentials.Credentials) *aws.Config {
+	config := &aws.Config{
+		Credentials: creds,
+		// retries are handled by the RetryPolicy of the provider
+		MaxRetries: aws.Int(0),
+	}
+	if e.Region != "" {
+		config.Region = aws.String(e.Region)
+	}
+	if e.URL != "" {
+		config.Endpoint = aws.String(e.URL)
+	}
+	if e.Regional {
+		config.STSRegionalEndpoint = endpoints.RegionalSTSEndpoint
+	}
+	if e.UseFIPS {
+		config.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+	}
+	if e.UseDualStack {
+		config.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+	}
+	return config
+}
@@ -0,0 +1,25 @@
+package gitlabcreds
+
+import "testing"
+
+func TestSTSEndpointValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint STSEndpoint
+		wantErr  bool
+	}{
+		{"defaults", STSEndpoint{}, false},
+		{"regional", STSEndpoint{Region: "eu-west-1", Regional: true}, false},
+		{"regional without region", STSEndpoint{Regional: true}, true},
+		{"endpoint url", STSEndpoint{URL: "http://localhost:8080"}, false},
+		{"endpoint url without scheme", STSEndpoint{URL: "localhost:8080"}, true},
+		{"endpoint url without host", STSEndpoint{URL: "https://"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.endpoint.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package gitlabcreds
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awssts "github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxSessionPolicySize the maximum number of characters of the inline and managed session policies combined.
+	MaxSessionPolicySize = 2048
+	// MaxSessionPolicyArns the maximum number of managed session policies.
+	MaxSessionPolicyArns = 10
+)
+
+// SessionPolicy the inline and managed policies to scope down the assumed role session.
+type SessionPolicy struct {
+	Policy     string
+	PolicyFile string
+	PolicyArns []string
+}
+
+// IsEmpty returns true if no session policy is specified.
+func (p *SessionPolicy) IsEmpty() bool {
+	return p.Policy == "" && p.PolicyFile == "" && len(p.PolicyArns) == 0
+}
+
+// Resolve reads the policy file, validates the inline policy as JSON and checks the size limits. It returns
+// the compacted inline policy, or an empty string if there is none.
+func (p *SessionPolicy) Resolve() (string, error) {
+	if p.Policy != "" && p.PolicyFile != "" {
+		return "", errors.New("specify either an inline session policy or a session policy file, not both")
+	}
+
+	policy := p.Policy
+	source := "the inline session policy"
+	if p.PolicyFile != "" {
+		content, err := os.ReadFile(p.PolicyFile)
+		if err != nil {
+			return "", errors.Errorf("failed to read the session policy file %s, %s", p.PolicyFile, err)
+		}
+		policy = string(content)
+		source = "the session policy in " + p.PolicyFile
+	}
+
+	var compacted bytes.Buffer
+	if policy != "" {
+		if err := json.Compact(&compacted, []byte(policy)); err != nil {
+			return "", errors.Errorf("%s is not valid JSON, %s", source, err)
+		}
+		var document map[string]interface{}
+		if err := json.Unmarshal(compacted.Bytes(), &document); err != nil {
+			return "", errors.Errorf("%s is not a JSON object", source)
+		}
+	}
+
+	if len(p.PolicyArns) > MaxSessionPolicyArns {
+		return "", errors.Errorf("%d managed session policies specified, the maximum is %d", len(p.PolicyArns), MaxSessionPolicyArns)
+	}
+	size := compacted.Len()
+	for _, arn := range p.PolicyArns {
+		if !strings.HasPrefix(arn, "arn:") || !strings.Contains(arn, ":policy/") {
+			return "", errors.Errorf("%s is not a valid managed policy arn", arn)
+		}
+		size += len(arn)
+	}
+	if size > MaxSessionPolicySize {
+		return "", errors.Errorf("the session policies are %d characters long, which exceeds the maximum of %d characters allowed by STS", size, MaxSessionPolicySize)
+	}
+	return compacted.String(), nil
+}
+
+// PolicyDescriptors returns the managed session policies as STS policy descriptors.
+func (p *SessionPolicy) PolicyDescriptors() []*awssts.PolicyDescriptorType {
+	if len(p.PolicyArns) == 0 {
+		return nil
+	}
+	result := make([]*awssts.PolicyDescriptorType, 0, len(p.PolicyArns))
+	for _, arn := range p.PolicyArns {
+		result = append(result, &awssts.PolicyDescriptorType{Arn: aws.String(arn)})
+	}
+	return result
+}
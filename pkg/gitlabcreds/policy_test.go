@@ -0,0 +1,51 @@
+package gitlabcreds
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSessionPolicyResolve(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(policyFile, []byte("{\n  \"Version\": \"2012-10-17\",\n  \"Statement\": []\n}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tooManyArns := make([]string, MaxSessionPolicyArns+1)
+	for i := range tooManyArns {
+		tooManyArns[i] = "arn:aws:iam::aws:policy/ReadOnlyAccess"
+	}
+
+	tests := []struct {
+		name    string
+		policy  SessionPolicy
+		want    string
+		wantErr string
+	}{
+		{"none", SessionPolicy{}, "", ""},
+		{"inline", SessionPolicy{Policy: `{ "Version": "2012-10-17" }`}, `{"Version":"2012-10-17"}`, ""},
+		{"file", SessionPolicy{PolicyFile: policyFile}, `{"Version":"2012-10-17","Statement":[]}`, ""},
+		{"managed", SessionPolicy{PolicyArns: []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}}, "", ""},
+		{"inline and file", SessionPolicy{Policy: "{}", PolicyFile: policyFile}, "", "not both"},
+		{"missing file", SessionPolicy{PolicyFile: policyFile + ".missing"}, "", "failed to read"},
+		{"invalid json", SessionPolicy{Policy: `{"Version": }`}, "", "not valid JSON"},
+		{"not an object", SessionPolicy{Policy: `[]`}, "", "not a JSON object"},
+		{"invalid arn", SessionPolicy{PolicyArns: []string{"ReadOnlyAccess"}}, "", "not a valid managed policy arn"},
+		{"too many arns", SessionPolicy{PolicyArns: tooManyArns}, "", "the maximum is 10"},
+		{"too large", SessionPolicy{Policy: `{"Sid":"` + strings.Repeat("x", MaxSessionPolicySize) + `"}`}, "", "exceeds the maximum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.Resolve()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Resolve() unexpected error %s", err)
+			} else if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Resolve() error = %v, want %s", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+// Package gitlabcreds provides AWS credentials for a Gitlab CI/CD job, by assuming an IAM role with the
+// id token of the job. The Provider implements the credentials.Provider interface of the aws-sdk-go, and
+// is adapted to the aws.CredentialsProvider interface of the aws-sdk-go-v2 by V2CredentialsProvider:
+//
+//	provider := gitlabcreds.NewProvider(gitlabcreds.Options{
+//		RoleArn: "arn:aws:iam::123456789012:role/gitlab-deployer",
+//	})
+//	sess := session.Must(session.NewSession(&aws.Config{
+//		Credentials: credentials.NewCredentials(provider),
+//	}))
+package gitlabcreds
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	awssts "github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/pkg/errors"
+)
+
+// ProviderName the name of the provider, as reported in the credentials value.
+const ProviderName = "GitlabWebIdentityProvider"
+
+// DefaultTokenName the environment variable with the id token, when no token source is specified.
+const DefaultTokenName = "GITLAB_AWS_IDENTITY_TOKEN"
+
+// Options the settings of the provider. The role is specified either by RoleArn, or by AwsAccount
+// and RoleName. AwsAccount may be an alias in Accounts. RoleName and RoleSessionName may be templates,
+// see RenderName.
+type Options struct {
+	RoleArn          string
+	AwsAccount       string
+	Accounts         map[string]string
+	RoleName         string
+	RoleSessionName  string
+	Partition        string
+	DurationSeconds  int64
+	PipelineId       string
+	ProjectPathSlug  string
+	TokenSource      TokenSource
+	ExpectedAudience string
+	ExpectedIssuer   string
+	RoleChainSpecs   []string
+	SessionPolicy    SessionPolicy
+	STSEndpoint      STSEndpoint
+	Retry            RetryPolicy
+	Region           string
+	RefreshMargin    time.Duration
+	// NewSTSClient creates the STS client calling with the credentials, defaults to a client for the STSEndpoint.
+	NewSTSClient func(creds *credentials.Credentials) (stsiface.STSAPI, error)
+}
+
+// DefaultOptions returns the options with the default session duration, retry policy and refresh margin.
+func DefaultOptions() Options {
+	return Options{
+		DurationSeconds: 3600,
+		Retry:           DefaultRetryPolicy(),
+		RefreshMargin:   5 * time.Minute,
+	}
+}
+
+// Provider assumes the role with the web identity token, and assumes the roles in the role chain. The
+// credentials are refreshed when they expire within the refresh margin. It is safe for concurrent use.
+type Provider struct {
+	Options
+	WebIdentityToken string
+	Token            *Token
+	RoleChain        []RoleChainHop
+	InlinePolicy     string
+	Credentials      *awssts.Credentials
+	STS              stsiface.STSAPI
+	resolved         bool
+	mutex            sync.Mutex
+}
+
+// NewProvider creates a provider with the options. Unset durations and retry settings take the defaults.
+func NewProvider(options Options) *Provider {
+	defaults := DefaultOptions()
+	if options.DurationSeconds == 0 {
+		options.DurationSeconds = defaults.DurationSeconds
+	}
+	if options.Retry.MaxAttempts == 0 {
+		options.Retry = defaults.Retry
+	}
+	if options.RefreshMargin == 0 {
+		options.RefreshMargin = defaults.RefreshMargin
+	}
+	return &Provider{Options: options}
+}
+
+// ReadWebIdentityToken reads the web identity token from the token source and decodes it.
+func (p *Provider) ReadWebIdentityToken() (err error) {
+	if p.TokenSource == nil {
+		p.TokenSource = NewEnvTokenSourceWithFallback(DefaultTokenName)
+	}
+	if p.WebIdentityToken, err = p.TokenSource.Token(); err != nil {
+		return err
+	}
+	p.Token, err = ParseToken(p.WebIdentityToken)
+	return err
+}
+
+// RenderNames renders the role name and role session name templates.
+func (p *Provider) RenderNames() (err error) {
+	data := &TemplateData{
+		PipelineId:      p.PipelineId,
+		ProjectPathSlug: p.ProjectPathSlug,
+		AwsAccount:      p.AwsAccount,
+	}
+	if p.Token != nil {
+		data.Claims = p.Token.Claims
+	}
+	if p.RoleName, err = RenderRoleName(p.RoleName, data); err != nil {
+		return err
+	}
+	data.RoleName = p.RoleName
+	p.RoleSessionName, err = RenderName("role session name", p.RoleSessionName, data)
+	return err
+}
+
+// ResolvePartition determines the partition from the role arn or the region, and sets the region of the
+// STS endpoint to the default region of the partition if no region is specified.
+func (p *Provider) ResolvePartition(arnPartition string) error {
+	regionPartition, knownRegion := PartitionForRegion(p.STSEndpoint.Region)
+	if p.Partition == "" {
+		if p.Partition = arnPartition; p.Partition == "" {
+			if p.Partition = regionPartition; !knownRegion {
+				p.Partition = "aws"
+			}
+		}
+	}
+	if err := ValidatePartition(p.Partition); err != nil {
+		return err
+	}
+	if arnPartition != "" && arnPartition != p.Partition {
+		return errors.Errorf("the role arn is in partition %s, but the partition is %s", arnPartition, p.Partition)
+	}
+	if p.STSEndpoint.Region == "" {
+		if p.Partition != "aws" {
+			if p.STSEndpoint.Region = DefaultRegions[p.Partition]; p.STSEndpoint.Region == "" {
+				return errors.Errorf("no default region for partition %s. Use --sts-region or set the environment variable GITLAB_AWS_STS_REGION", p.Partition)
+			}
+		}
+	} else if knownRegion && regionPartition != p.Partition {
+		return errors.Errorf("the region %s is in partition %s, but the partition is %s", p.STSEndpoint.Region, regionPartition, p.Partition)
+	}
+	return nil
+}
+
+// ResolveRole validates the settings and determines the role arn, role session name and web identity token.
+func (p *Provider) ResolveRole() error {
+	var err error
+	var roleArn RoleArn
+	if p.RoleArn != "" {
+		if roleArn, err = ParseRoleArn(p.RoleArn); err != nil {
+			return err
+		}
+		p.AwsAccount, p.RoleName = roleArn.AccountId, roleArn.Name
+	}
+
+	if p.RoleName == "" {
+		return errors.New("the role name is not set. Perhaps the environment variable CI_PROJECT_PATH_SLUG is not present")
+	}
+	if p.AwsAccount == "" {
+		return errors.New("the AWS account is not set. Use --aws-account or set the environment variable GITLAB_AWS_ACCOUNT_ID")
+	}
+	if p.AwsAccount, err = ResolveAccount(p.AwsAccount, p.Accounts); err != nil {
+		return err
+	}
+	if p.Retry.MaxAttempts <= 0 {
+		return errors.New("the maximum number of attempts must be a positive integer")
+	}
+	if p.STSEndpoint.Region == "" {
+		p.STSEndpoint.Region = p.Region
+	}
+	if err = p.ResolvePartition(roleArn.Partition); err != nil {
+		return err
+	}
+	if err = p.STSEndpoint.Validate(); err != nil {
+		return err
+	}
+
+	if err = p.ReadWebIdentityToken(); err != nil {
+		return err
+	}
+	if err = p.Token.Validate(time.Now(), p.ExpectedAudience, p.ExpectedIssuer); err != nil {
+		return err
+	}
+
+	if err = p.RenderNames(); err != nil {
+		return err
+	}
+
+	if p.RoleArn == "" {
+		path, name := SplitRolePath(p.RoleName)
+		roleArn = RoleArn{Partition: p.Partition, AccountId: p.AwsAccount, Path: path, Name: name}
+		if err = roleArn.Validate(); err != nil {
+			return err
+		}
+		p.RoleName = name
+		p.RoleArn = roleArn.String()
+	}
+
+	if p.RoleSessionName == "" {
+		p.RoleSessionName = GenerateRoleSessionName(p.RoleName, p.PipelineId)
+	}
+
+	if p.RoleChain, err = ParseRoleChain(p.RoleChainSpecs); err != nil {
+		return err
+	}
+	if p.InlinePolicy, err = p.SessionPolicy.Resolve(); err != nil {
+		return err
+	}
+	p.resolved = true
+	return nil
+}
+
+// AssumeRole assumes the resolved role with the web identity token.
+func (p *Provider) AssumeRole() error {
+	var err error
+	if p.STS == nil {
+		if p.STS, err = p.newSTSClient(credentials.AnonymousCredentials); err != nil {
+			return err
+		}
+	}
+
+	input := &awssts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(p.RoleArn),
+		RoleSessionName:  aws.String(p.RoleSessionName),
+		WebIdentityToken: aws.String(p.WebIdentityToken),
+		DurationSeconds:  aws.Int64(p.DurationSeconds),
+	}
+	if len(p.RoleChain) == 0 {
+		input.Policy, input.PolicyArns = p.sessionPolicyInput()
+	}
+
+	var result *awssts.AssumeRoleWithWebIdentityOutput
+	err = p.Retry.Do("AssumeRoleWithWebIdentity", func(ctx context.Context) (err error) {
+		result, err = p.STS.AssumeRoleWithWebIdentityWithContext(ctx, input)
+		return err
+	})
+	if err == nil {
+		p.Credentials = result.Credentials
+	} else {
+		return err
+	}
+
+	return p.AssumeRoleChain()
+}
+
+// newSTSClient creates an STS client calling with the credentials.
+func (p *Provider) newSTSClient(creds *credentials.Credentials) (stsiface.STSAPI, error) {
+	if p.NewSTSClient != nil {
+		return p.NewSTSClient(creds)
+	}
+	session, err := p.STSEndpoint.NewSession(creds)
+	if err != nil {
+		return nil, err
+	}
+	return awssts.New(session), nil
+}
+
+// sessionPolicyInput returns the session policy parameters for the final role assumed.
+func (p *Provider) sessionPolicyInput() (policy *string, policyArns []*awssts.PolicyDescriptorType) {
+	if p.InlinePolicy != "" {
+		policy = aws.String(p.InlinePolicy)
+	}
+	return policy, p.SessionPolicy.PolicyDescriptors()
+}
+
+func (p *Provider) isValid(now time.Time) bool {
+	return p.Credentials != nil && p.Credentials.Expiration != nil && now.Add(p.RefreshMargin).Before(*p.Credentials.Expiration)
+}
+
+// GetCredentials returns valid credentials, resolving the role on the first call and assuming the role
+// again with a freshly read id token when the credentials expire within the refresh margin.
+func (p *Provider) GetCredentials() (*awssts.Credentials, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.isValid(time.Now()) {
+		return p.Credentials, nil
+	}
+	if !p.resolved {
+		if err := p.ResolveRole(); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := p.ReadWebIdentityToken(); err != nil {
+			return nil, err
+		}
+		if err := p.Token.Validate(time.Now(), p.ExpectedAudience, p.ExpectedIssuer); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.AssumeRole(); err != nil {
+		return nil, err
+	}
+	return p.Credentials, nil
+}
+
+// Retrieve returns the credentials, implementing the credentials.Provider interface of the aws-sdk-go.
+func (p *Provider) Retrieve() (credentials.Value, error) {
+	result, err := p.GetCredentials()
+	if err != nil {
+		return credentials.Value{ProviderName: ProviderName}, err
+	}
+	return credentials.Value{
+		AccessKeyID:     aws.StringValue(result.AccessKeyId),
+		SecretAccessKey: aws.StringValue(result.SecretAccessKey),
+		SessionToken:    aws.StringValue(result.SessionToken),
+		ProviderName:    ProviderName,
+	}, nil
+}
+
+// IsExpired returns true if the credentials expire within the refresh margin, implementing the
+// credentials.Provider interface of the aws-sdk-go.
+func (p *Provider) IsExpired() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return !p.isValid(time.Now())
+}
+
+// ExpiresAt returns the expiration time of the credentials, implementing the credentials.Expirer
+// interface of the aws-sdk-go.
+func (p *Provider) ExpiresAt() time.Time {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.Credentials == nil || p.Credentials.Expiration == nil {
+		return time.Time{}
+	}
+	return *p.Credentials.Expiration
+}
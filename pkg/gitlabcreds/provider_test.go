@@ -0,0 +1,193 @@
+package gitlabcreds
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awssts "github.com/aws/aws-sdk-go/service/sts"
+	"github.com/binxio/gitlab-aws-credential-helper/pkg/gitlabcreds/ststest"
+)
+
+type staticTokenSource string
+
+func (s staticTokenSource) Token() (string, error) {
+	return string(s), nil
+}
+
+func newTestProvider(t *testing.T) (*Provider, *ststest.Server) {
+	server := ststest.NewServer()
+	t.Cleanup(server.Close)
+	provider := NewProvider(Options{
+		RoleArn:      "arn:aws:iam::123456789012:role/gitlab-deployer",
+		PipelineId:   "1234",
+		TokenSource:  staticTokenSource(ststest.IdentityToken(nil)),
+		NewSTSClient: server.NewSTSClient,
+	})
+	provider.Retry.Sleep = func(time.Duration) {}
+	return provider, server
+}
+
+func TestProviderRetrieve(t *testing.T) {
+	provider, server := newTestProvider(t)
+	if !provider.IsExpired() {
+		t.Errorf("expected a new provider to be expired")
+	}
+	for i := 0; i < 2; i++ {
+		value, err := provider.Retrieve()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value.AccessKeyID != "ASIAFAKE000000000001" || value.ProviderName != ProviderName {
+			t.Errorf("unexpected credentials %+v", value)
+		}
+	}
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("expected the role to be assumed once, got %d", len(requests))
+	}
+	if r := requests[0]; r.Action != "AssumeRoleWithWebIdentity" || r.RoleSessionName != "gitlab-deployer-1234" || r.DurationSeconds != 3600 {
+		t.Errorf("unexpected request %+v", r)
+	}
+	if provider.IsExpired() || provider.ExpiresAt().Before(time.Now().Add(50*time.Minute)) {
+		t.Errorf("expected the credentials to be valid for an hour")
+	}
+}
+
+func TestProviderAccountAlias(t *testing.T) {
+	provider, server := newTestProvider(t)
+	provider.RoleArn = ""
+	provider.AwsAccount, provider.RoleName = "prod", "deployer"
+	provider.Accounts = map[string]string{"prod": "210987654321"}
+	if _, err := provider.Retrieve(); err != nil {
+		t.Fatal(err)
+	}
+	if r := server.Requests()[0]; r.RoleArn != "arn:aws:iam::210987654321:role/deployer" {
+		t.Errorf("expected the role in the account of the alias, got %s", r.RoleArn)
+	}
+
+	provider, server = newTestProvider(t)
+	provider.RoleArn = ""
+	provider.AwsAccount, provider.RoleName = "prdo", "deployer"
+	if _, err := provider.Retrieve(); err == nil || len(server.Requests()) != 0 {
+		t.Errorf("expected an unknown alias to fail before calling STS, got %v", err)
+	}
+}
+
+func TestProviderRefresh(t *testing.T) {
+	provider, server := newTestProvider(t)
+	server.Default.Credentials = &awssts.Credentials{
+		AccessKeyId:     aws.String("ASIASHORT"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(2 * time.Minute)),
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := provider.Retrieve(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(server.Requests()); n != 2 {
+		t.Errorf("expected credentials within the refresh margin to be refreshed, got %d requests", n)
+	}
+	if !provider.IsExpired() {
+		t.Errorf("expected credentials within the refresh margin to be expired")
+	}
+}
+
+func TestProviderErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		responses   []ststest.Response
+		maxAttempts int
+		requests    int
+		wantErr     string
+	}{
+		{"access denied", []ststest.Response{{ErrorCode: "AccessDenied", ErrorMessage: "not authorized"}}, 3, 1, "AccessDenied: not authorized"},
+		{"throttled", []ststest.Response{{ErrorCode: "Throttling"}, {ErrorCode: "Throttling"}}, 3, 3, ""},
+		{"unavailable", []ststest.Response{{ErrorCode: "ServiceUnavailable", StatusCode: 503}, {ErrorCode: "ServiceUnavailable", StatusCode: 503}}, 2, 2, "AssumeRoleWithWebIdentity failed after 2 attempts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, server := newTestProvider(t)
+			provider.Retry.MaxAttempts = tt.maxAttempts
+			server.Enqueue(tt.responses...)
+			_, err := provider.Retrieve()
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected error %s, got %v", tt.wantErr, err)
+			}
+			if n := len(server.Requests()); n != tt.requests {
+				t.Errorf("expected %d requests, got %d", tt.requests, n)
+			}
+		})
+	}
+}
+
+func TestProviderRetryDeadline(t *testing.T) {
+	provider, server := newTestProvider(t)
+	provider.Retry.Sleep = time.Sleep
+	provider.Retry.BaseDelay = time.Millisecond
+	provider.Retry.Deadline = 100 * time.Millisecond
+	server.Default = ststest.Response{ErrorCode: "Throttling", Latency: 60 * time.Millisecond}
+	if _, err := provider.Retrieve(); err == nil || !strings.Contains(err.Error(), "within the retry deadline") {
+		t.Errorf("expected the retry deadline to be exceeded, got %v", err)
+	}
+
+	provider, server = newTestProvider(t)
+	provider.Retry.Deadline = 50 * time.Millisecond
+	server.Default = ststest.Response{Latency: time.Second}
+	start := time.Now()
+	if _, err := provider.Retrieve(); err == nil || !strings.Contains(err.Error(), "within the retry deadline") {
+		t.Errorf("expected a hanging call to be cancelled at the retry deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the call to be cancelled at the retry deadline, took %s", elapsed)
+	}
+}
+
+func TestProviderRoleChain(t *testing.T) {
+	provider, server := newTestProvider(t)
+	provider.DurationSeconds = 7200
+	provider.RoleChainSpecs = []string{"arn:aws:iam::210987654321:role/deployer,external-id=secret"}
+	provider.SessionPolicy.PolicyArns = []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}
+	value, err := provider.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := server.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	if len(requests[0].PolicyArns) != 0 {
+		t.Errorf("expected no session policy on the first hop")
+	}
+	hop := requests[1]
+	if hop.Action != "AssumeRole" || hop.RoleArn != "arn:aws:iam::210987654321:role/deployer" || hop.ExternalId != "secret" ||
+		hop.DurationSeconds != 3600 || hop.AccessKeyId != "ASIAFAKE000000000001" || len(hop.PolicyArns) != 1 {
+		t.Errorf("unexpected role chain request %+v", hop)
+	}
+	if value.AccessKeyID != "ASIAFAKE000000000002" {
+		t.Errorf("expected the credentials of the last hop, got %s", value.AccessKeyID)
+	}
+}
+
+func TestV2CredentialsProvider(t *testing.T) {
+	provider, _ := newTestProvider(t)
+	credentials, err := V2CredentialsProvider{Provider: provider}.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials.AccessKeyID != "ASIAFAKE000000000001" || credentials.SessionToken != "token-1" || !credentials.CanExpire || credentials.Expires.Before(time.Now()) {
+		t.Errorf("unexpected credentials %+v", credentials)
+	}
+
+	failing := V2CredentialsProvider{Provider: NewProvider(Options{})}
+	if _, err = failing.Retrieve(context.Background()); err == nil {
+		t.Errorf("expected an error without a role")
+	}
+}
@@ -0,0 +1,100 @@
+package gitlabcreds
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+)
+
+// TransientErrorCodes the STS error codes which are retried.
+var TransientErrorCodes = map[string]bool{
+	"Throttling":            true,
+	"ThrottlingException":   true,
+	"RequestLimitExceeded":  true,
+	"IDPCommunicationError": true,
+	"ServiceUnavailable":    true,
+	"InternalFailure":       true,
+	"RequestError":          true,
+}
+
+// RetryPolicy retries an operation failing with a transient error, using exponential backoff with full jitter.
+type RetryPolicy struct {
+	MaxAttempts int
+	Deadline    time.Duration
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Sleep       func(time.Duration)
+}
+
+// DefaultRetryPolicy returns the default retry policy of 5 attempts within one minute.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		Deadline:    time.Minute,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    20 * time.Second,
+	}
+}
+
+// IsTransientError returns true if the error is an AWS error with a transient error code.
+func IsTransientError(err error) bool {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return TransientErrorCodes[awsErr.Code()]
+	}
+	return false
+}
+
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.MaxDelay
+	if attempt < 30 {
+		if d := p.BaseDelay << uint(attempt-1); d > 0 && d < p.MaxDelay {
+			delay = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// Do calls the operation until it succeeds, fails with a non-transient error, the maximum number of attempts
+// is reached or the next attempt would exceed the deadline. The context passed to the operation is cancelled
+// at the deadline, so that a hanging call does not outlast it. The error of the last attempt is wrapped, so
+// that its AWS error code remains available.
+func (p *RetryPolicy) Do(operation string, fn func(ctx context.Context) error) error {
+	sleep := p.Sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	start := time.Now()
+	ctx := context.Background()
+	if p.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, start.Add(p.Deadline))
+		defer cancel()
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return errors.Wrapf(err, "%s failed after %d attempts within the retry deadline of %s", operation, attempt, p.Deadline)
+		}
+		if !IsTransientError(err) {
+			if attempt == 1 {
+				return err
+			}
+			return errors.Wrapf(err, "%s failed after %d attempts", operation, attempt)
+		}
+		if attempt >= p.MaxAttempts {
+			return errors.Wrapf(err, "%s failed after %d attempts", operation, attempt)
+		}
+		delay := p.backoff(attempt)
+		if p.Deadline > 0 && time.Since(start)+delay > p.Deadline {
+			return errors.Wrapf(err, "%s failed after %d attempts within the retry deadline of %s", operation, attempt, p.Deadline)
+		}
+		sleep(delay)
+	}
+}
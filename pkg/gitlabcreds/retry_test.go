@@ -0,0 +1,68 @@
+package gitlabcreds
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestRetryPolicyDo(t *testing.T) {
+	throttled := awserr.New("Throttling", "Rate exceeded", nil)
+	denied := awserr.New("AccessDenied", "Not authorized to perform sts:AssumeRoleWithWebIdentity", nil)
+
+	tests := []struct {
+		name         string
+		errs         []error
+		deadline     time.Duration
+		wantAttempts int
+		wantErr      string
+	}{
+		{"success", []error{nil}, time.Minute, 1, ""},
+		{"non transient error is not retried", []error{denied}, time.Minute, 1, "AccessDenied"},
+		{"transient error is retried", []error{throttled, awserr.New("IDPCommunicationError", "", nil), nil}, time.Minute, 3, ""},
+		{"non transient error after retry", []error{throttled, denied}, time.Minute, 2, "failed after 2 attempts"},
+		{"maximum attempts", []error{throttled, throttled, throttled, throttled}, time.Minute, 3, "failed after 3 attempts"},
+		{"deadline", []error{throttled, throttled}, time.Nanosecond, 1, "within the retry deadline"},
+		{"plain error", []error{errors.New("failed")}, time.Minute, 1, "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var slept time.Duration
+			policy := RetryPolicy{
+				MaxAttempts: 3,
+				Deadline:    tt.deadline,
+				BaseDelay:   time.Second,
+				MaxDelay:    4 * time.Second,
+				Sleep:       func(d time.Duration) { slept += d },
+			}
+			attempts := 0
+			start := time.Now()
+			err := policy.Do("AssumeRoleWithWebIdentity", func(ctx context.Context) error {
+				if deadline, ok := ctx.Deadline(); !ok || deadline.Before(start.Add(tt.deadline)) {
+					t.Errorf("expected the context to have the retry deadline of %s, got %s", tt.deadline, deadline)
+				}
+				attempts++
+				return tt.errs[attempts-1]
+			})
+			if attempts != tt.wantAttempts {
+				t.Errorf("Do() made %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Do() unexpected error %s", err)
+			} else if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Do() error = %v, want %s", err, tt.wantErr)
+			}
+			var awsErr awserr.Error
+			if want, ok := tt.errs[attempts-1].(awserr.Error); ok && (!errors.As(err, &awsErr) || awsErr.Code() != want.Code()) {
+				t.Errorf("Do() error = %v, want the AWS error %s to be preserved", err, want.Code())
+			}
+			if slept > time.Duration(attempts-1)*policy.MaxDelay {
+				t.Errorf("Do() slept %s, which exceeds the maximum delay", slept)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+// Package ststest provides an in-process fake of the AWS Security Token Service, for end-to-end tests of
+// code assuming roles with AssumeRoleWithWebIdentity and AssumeRole.
+//
+//	server := ststest.NewServer()
+//	defer server.Close()
+//	server.Enqueue(ststest.Response{ErrorCode: "Throttling"})
+//	os.Setenv("GITLAB_AWS_STS_ENDPOINT_URL", server.URL)
+package ststest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awssts "github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// Response the behaviour of the server for a single request.
+type Response struct {
+	// Latency the time to wait before responding.
+	Latency time.Duration
+	// ErrorCode the STS error code to return, like AccessDenied or Throttling, instead of credentials.
+	ErrorCode string
+	// ErrorMessage the message of the error.
+	ErrorMessage string
+	// StatusCode the HTTP status of the error response, defaults to 400.
+	StatusCode int
+	// Credentials the credentials to return, instead of generated credentials.
+	Credentials *awssts.Credentials
+}
+
+// Request an STS request received by the server.
+type Request struct {
+	Action           string
+	RoleArn          string
+	RoleSessionName  string
+	WebIdentityToken string
+	DurationSeconds  int64
+	ExternalId       string
+	Policy           string
+	PolicyArns       []string
+	// AccessKeyId the access key id the request was signed with, empty for AssumeRoleWithWebIdentity.
+	AccessKeyId string
+}
+
+// Server a fake STS endpoint. Requests are answered with the queued responses in order, and with the
+// Default response once the queue is empty. Generated credentials have a unique access key id, and
+// expire after the requested duration.
+type Server struct {
+	*httptest.Server
+	Default   Response
+	mutex     sync.Mutex
+	responses []Response
+	requests  []Request
+}
+
+// NewServer starts a fake STS server returning generated credentials.
+func NewServer() *Server {
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Enqueue adds responses for the next requests.
+func (s *Server) Enqueue(responses ...Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.responses = append(s.responses, responses...)
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// NewSTSClient returns an STS client for the server, calling it with the credentials.
+func (s *Server) NewSTSClient(creds *credentials.Credentials) (stsiface.STSAPI, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Credentials: creds,
+		Endpoint:    aws.String(s.URL),
+		Region:      aws.String("us-east-1"),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return awssts.New(sess), nil
+}
+
+// Setenv configures the credential helper through its environment variables to assume the role on the server
+// in us-east-1 with a valid id token, and clears the variables which would change the outcome, for the duration
+// of the test. The configuration, AWS shared config and credentials files and the cache are looked up in an empty
+// temporary directory.
+func (s *Server) Setenv(t testing.TB, roleArn string) {
+	configDir := t.TempDir()
+	for name, value := range map[string]string{
+		"GITLAB_AWS_ROLE_ARN":                roleArn,
+		"GITLAB_AWS_IDENTITY_TOKEN":          IdentityToken(nil),
+		"GITLAB_AWS_STS_ENDPOINT_URL":        s.URL,
+		"CI_PIPELINE_ID":                     "1234",
+		"GITLAB_AWS_ACCOUNT_ID":              "",
+		"GITLAB_AWS_ROLE_NAME":               "",
+		"GITLAB_AWS_ROLE_SESSION_NAME":       "",
+		"GITLAB_AWS_ROLE_CHAIN":              "",
+		"GITLAB_AWS_DURATION_SECONDS":        "",
+		"GITLAB_AWS_PARTITION":               "",
+		"GITLAB_AWS_IDENTITY_TOKEN_NAME":     "",
+		"GITLAB_AWS_IDENTITY_TOKEN_FILE":     "",
+		"GITLAB_AWS_EXPECTED_AUDIENCE":       "",
+		"GITLAB_AWS_EXPECTED_ISSUER":         "",
+		"GITLAB_AWS_POLICY":                  "",
+		"GITLAB_AWS_POLICY_FILE":             "",
+		"GITLAB_AWS_POLICY_ARNS":             "",
+		"CI_SERVER_URL":                      "",
+		"CI_PROJECT_PATH_SLUG":               "",
+		"GITLAB_AWS_REGION":                  "",
+		"GITLAB_AWS_STS_REGION":              "us-east-1",
+		"GITLAB_AWS_STS_REGIONAL_ENDPOINT":   "",
+		"GITLAB_AWS_USE_FIPS_ENDPOINT":       "",
+		"GITLAB_AWS_USE_DUALSTACK_ENDPOINT":  "",
+		"AWS_REGION":                         "",
+		"AWS_DEFAULT_REGION":                 "",
+		"GITLAB_AWS_MAX_ATTEMPTS":            "1",
+		"GITLAB_AWS_RETRY_DEADLINE":          "",
+		"GITLAB_AWS_REFRESH_MARGIN":          "",
+		"GITLAB_AWS_PROFILE":                 "",
+		"GITLAB_AWS_PROFILES_FILE":           "",
+		"GITLAB_AWS_CACHE_DIR":               "",
+		"GITLAB_AWS_ENV_FORMAT":              "",
+		"GITLAB_AWS_SERVE_ADDRESS":           "",
+		"GITLAB_AWS_IMDS_ADDRESS":            "",
+		"GITLAB_AWS_WEB_IDENTITY_TOKEN_FILE": "",
+		"AWS_SHARED_CREDENTIALS_FILE":        filepath.Join(configDir, ".aws", "credentials"),
+		"AWS_CONFIG_FILE":                    filepath.Join(configDir, ".aws", "config"),
+		"CI_PROJECT_DIR":                     configDir,
+		"XDG_CONFIG_HOME":                    configDir,
+		"XDG_CACHE_HOME":                     configDir,
+		"HOME":                               configDir,
+		"AppData":                            configDir,
+		"LocalAppData":                       configDir,
+	} {
+		t.Setenv(name, value)
+	}
+}
+
+var credentialPattern = regexp.MustCompile(`Credential=([^/]+)/`)
+
+func (s *Server) next(r *http.Request) (request Request, response Response, n int) {
+	request = Request{
+		Action:           r.PostForm.Get("Action"),
+		RoleArn:          r.PostForm.Get("RoleArn"),
+		RoleSessionName:  r.PostForm.Get("RoleSessionName"),
+		WebIdentityToken: r.PostForm.Get("WebIdentityToken"),
+		ExternalId:       r.PostForm.Get("ExternalId"),
+		Policy:           r.PostForm.Get("Policy"),
+	}
+	request.DurationSeconds, _ = strconv.ParseInt(r.PostForm.Get("DurationSeconds"), 10, 64)
+	for i := 1; r.PostForm.Has(fmt.Sprintf("PolicyArns.member.%d.arn", i)); i++ {
+		request.PolicyArns = append(request.PolicyArns, r.PostForm.Get(fmt.Sprintf("PolicyArns.member.%d.arn", i)))
+	}
+	if match := credentialPattern.FindStringSubmatch(r.Header.Get("Authorization")); match != nil {
+		request.AccessKeyId = match[1]
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requests = append(s.requests, request)
+	response = s.Default
+	if len(s.responses) > 0 {
+		response, s.responses = s.responses[0], s.responses[1:]
+	}
+	return request, response, len(s.requests)
+}
+
+type xmlError struct {
+	XMLName   xml.Name `xml:"ErrorResponse"`
+	Type      string   `xml:"Error>Type"`
+	Code      string   `xml:"Error>Code"`
+	Message   string   `xml:"Error>Message"`
+	RequestId string   `xml:"RequestId"`
+}
+
+type xmlCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      string
+}
+
+type xmlResult struct {
+	XMLName         xml.Name
+	Credentials     xmlCredentials
+	AssumedRoleUser struct {
+		Arn           string
+		AssumedRoleId string
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request, response, n := s.next(r)
+	if response.Latency > 0 {
+		select {
+		case <-time.After(response.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	requestId := fmt.Sprintf("00000000-0000-0000-0000-%012d", n)
+	if response.ErrorCode == "" && request.Action != "AssumeRoleWithWebIdentity" && request.Action != "AssumeRole" {
+		response.ErrorCode, response.ErrorMessage = "InvalidAction", "unsupported action "+request.Action
+	}
+	if response.ErrorCode != "" {
+		status := response.StatusCode
+		if status == 0 {
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
+		_ = xml.NewEncoder(w).Encode(xmlError{Type: "Sender", Code: response.ErrorCode, Message: response.ErrorMessage, RequestId: requestId})
+		return
+	}
+
+	creds := response.Credentials
+	if creds == nil {
+		duration := request.DurationSeconds
+		if duration == 0 {
+			duration = 3600
+		}
+		creds = &awssts.Credentials{
+			AccessKeyId:     aws.String(fmt.Sprintf("ASIAFAKE%012d", n)),
+			SecretAccessKey: aws.String(fmt.Sprintf("secret-%d", n)),
+			SessionToken:    aws.String(fmt.Sprintf("token-%d", n)),
+			Expiration:      aws.Time(time.Now().Add(time.Duration(duration) * time.Second)),
+		}
+	}
+	var result xmlResult
+	result.XMLName.Local = request.Action + "Result"
+	result.Credentials = xmlCredentials{
+		AccessKeyId:     aws.StringValue(creds.AccessKeyId),
+		SecretAccessKey: aws.StringValue(creds.SecretAccessKey),
+		SessionToken:    aws.StringValue(creds.SessionToken),
+		Expiration:      aws.TimeValue(creds.Expiration).UTC().Format(time.RFC3339),
+	}
+	result.AssumedRoleUser.Arn = request.RoleArn + "/" + request.RoleSessionName
+	result.AssumedRoleUser.AssumedRoleId = "AROAFAKE:" + request.RoleSessionName
+
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName   xml.Name
+		Result    xmlResult
+		RequestId string `xml:"ResponseMetadata>RequestId"`
+	}{
+		XMLName:   xml.Name{Space: "https://sts.amazonaws.com/doc/2011-06-15/", Local: request.Action + "Response"},
+		Result:    result,
+		RequestId: requestId,
+	})
+}
+
+// IdentityToken returns an unsigned JSON web token with the claims, as a stand-in for a Gitlab id token.
+// The claims sub, aud and exp are added when absent, the token expires after one hour.
+func IdentityToken(claims map[string]interface{}) string {
+	payload := map[string]interface{}{
+		"sub": "project_path:binxio/demo:ref_type:branch:ref:main",
+		"aud": "https://gitlab.com",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range claims {
+		payload[name] = value
+	}
+	encode := func(value interface{}) string {
+		content, _ := json.Marshal(value)
+		return base64.RawURLEncoding.EncodeToString(content)
+	}
+	return encode(map[string]interface{}{"alg": "RS256", "typ": "JWT"}) + "." + encode(payload) + ".c2lnbmF0dXJl"
+}
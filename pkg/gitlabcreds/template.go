@@ -0,0 +1,124 @@
+package gitlabcreds
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// TemplateData the data available to the role name and role session name templates.
+type TemplateData struct {
+	Claims          map[string]interface{}
+	PipelineId      string
+	ProjectPathSlug string
+	AwsAccount      string
+	RoleName        string
+}
+
+var templateFuncs = template.FuncMap{
+	"env":   os.Getenv,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// IsTemplate returns true if the value contains a template action.
+func IsTemplate(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+// RenderName renders the name template and sanitizes the result to a valid role (session) name of at most
+// 64 characters. A value without template actions is returned as is.
+func RenderName(name, value string, data *TemplateData) (string, error) {
+	if !IsTemplate(value) {
+		return value, nil
+	}
+	result, err := render(name, value, data)
+	if err != nil {
+		return "", err
+	}
+	if sanitized := SanitizeName(result, 64); sanitized != "" {
+		return sanitized, nil
+	}
+	return "", errors.Errorf("the %s template '%s' rendered an empty name", name, value)
+}
+
+// RenderRoleName renders the role name template in the form [path/]name. The path and the name are rendered
+// separately, so that the slashes of the template separate the path, and the name is sanitized as by
+// RenderName. A value without template actions is returned as is.
+func RenderRoleName(value string, data *TemplateData) (string, error) {
+	if !IsTemplate(value) {
+		return value, nil
+	}
+	path, name := splitTemplatePath(value)
+	name, err := RenderName("role name", name, data)
+	if err != nil || path == "" {
+		return name, err
+	}
+	if path, err = render("role path", path, data); err != nil {
+		return "", err
+	}
+	return invalidPathCharacters.ReplaceAllString(path, "-") + name, nil
+}
+
+// render executes the template with the data.
+func render(name, value string, data *TemplateData) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", errors.Errorf("invalid %s template '%s', %s", name, value, err)
+	}
+	var result strings.Builder
+	if err = tmpl.Execute(&result, data); err != nil {
+		return "", errors.Errorf("failed to render %s template '%s', %s", name, value, err)
+	}
+	return result.String(), nil
+}
+
+// splitTemplatePath splits the template after the last slash outside of the template actions.
+func splitTemplatePath(value string) (path, name string) {
+	last, depth := -1, 0
+	for i := 0; i < len(value); i++ {
+		switch {
+		case strings.HasPrefix(value[i:], "{{"):
+			depth, i = depth+1, i+1
+		case strings.HasPrefix(value[i:], "}}") && depth > 0:
+			depth, i = depth-1, i+1
+		case value[i] == '/' && depth == 0:
+			last = i
+		}
+	}
+	return value[:last+1], value[last+1:]
+}
+
+func truncate(name string, maxLength int) string {
+	if len(name) < maxLength {
+		return name
+	}
+	return string([]rune(name)[0:maxLength])
+}
+
+var (
+	invalidNameCharacters = regexp.MustCompile(`[^=,.@A-Za-z0-9_]+`)
+	invalidPathCharacters = regexp.MustCompile(`[^\x21-\x7E]+`)
+)
+
+// SanitizeName replaces sequences of characters not allowed in a role (session) name by a single dash, removes
+// leading and trailing dashes and truncates the result to maxLength characters.
+func SanitizeName(name string, maxLength int) string {
+	return truncate(strings.Trim(invalidNameCharacters.ReplaceAllString(name, "-"), "-"), maxLength)
+}
+
+// GenerateRoleSessionName generates a valid role session name based on the role name and pipeline id.
+func GenerateRoleSessionName(roleName, pipelineId string) string {
+	if pipelineId == "" {
+		return SanitizeName(roleName, 64)
+	}
+	maxLength := 64 - len(pipelineId) - 1
+	if maxLength <= 0 {
+		return truncate(pipelineId, 64)
+	}
+	return fmt.Sprintf("%s-%s", SanitizeName(roleName, maxLength), pipelineId)
+}
@@ -0,0 +1,100 @@
+package gitlabcreds
+
+import "testing"
+
+func TestRenderName(t *testing.T) {
+	t.Setenv("CI_ENVIRONMENT_NAME", "Production")
+
+	data := &TemplateData{
+		Claims:     map[string]interface{}{"namespace_path": "binxio/platform"},
+		PipelineId: "1234",
+		RoleName:   "ci-deployer",
+	}
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"no template", "gitlab/role", "gitlab/role", false},
+		{"claims and env", `ci-{{.Claims.namespace_path}}-{{env "CI_ENVIRONMENT_NAME" | lower}}-deployer`, "ci-binxio-platform-production-deployer", false},
+		{"pipeline and role name", "{{.RoleName}}-{{.PipelineId}}", "ci-deployer-1234", false},
+		{"truncated", "{{.RoleName}}-0123456789012345678901234567890123456789012345678901234567890123456789", "ci-deployer-0123456789012345678901234567890123456789012345678901", false},
+		{"missing claim", "{{.Claims.environment}}", "", true},
+		{"invalid template", "{{.Claims", "", true},
+		{"empty result", `{{env "UNDEFINED_VARIABLE"}}`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderName("role name", tt.value, data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RenderName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RenderName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderRoleName(t *testing.T) {
+	data := &TemplateData{
+		Claims:     map[string]interface{}{"namespace_path": "binxio/platform"},
+		PipelineId: "1234",
+	}
+	tests := []struct {
+		name     string
+		value    string
+		wantPath string
+		wantName string
+	}{
+		{"no path", "ci-{{.Claims.namespace_path}}-deployer", "/", "ci-binxio-platform-deployer"},
+		{"path", "deploy/{{.PipelineId}}", "/deploy/", "1234"},
+		{"templated path", "/ci/{{.Claims.namespace_path}}/deployer-{{.PipelineId}}", "/ci/binxio/platform/", "deployer-1234"},
+		{"slash in action", `ci/{{printf "%s/%s" "a" "b"}}`, "/ci/", "a-b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderRoleName(tt.value, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path, name := SplitRolePath(got); path != tt.wantPath || name != tt.wantName {
+				t.Errorf("RenderRoleName() = %s, want path %s and name %s", got, tt.wantPath, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestGenerateRoleSessionName(t *testing.T) {
+	type args struct {
+		roleName   string
+		pipelineId string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{"no pipeline", args{"role", ""}, "role"},
+		{"role and pipeline", args{"role", "1234"}, "role-1234"},
+		{"no leading or trailing dash", args{"-role-", ""}, "role"},
+		{"invalid chars", args{"/gitlab/role", "1234"}, "gitlab-role-1234"},
+		{"multiple invalid chars", args{"/gitlab/role-%^$abc", "1234"}, "gitlab-role-abc-1234"},
+		{"all valid special chars", args{"foo=bar@binx.io_", "1234"}, "foo=bar@binx.io_-1234"},
+		{"keep dashes", args{"gitlab-role--nice", ""}, "gitlab-role-nice"},
+		{"truncated to 64 chars", args{"L9i3LA4rF2rtMhImJBdvsKiBEKeltlmz6VLeVMwalW6ZyWFgWtVYZxKQfKVMHK57", "232324"}, "L9i3LA4rF2rtMhImJBdvsKiBEKeltlmz6VLeVMwalW6ZyWFgWtVYZxKQf-232324"},
+		{"pipeline id longer than chars", args{"gitlab-role", "L9i3LA4rF2rtMhImJBdvsKiBEKeltlmz6VLeVMwalW6ZyWFgWtVYZxKQfKVMHK57AAA"}, "L9i3LA4rF2rtMhImJBdvsKiBEKeltlmz6VLeVMwalW6ZyWFgWtVYZxKQfKVMHK57"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GenerateRoleSessionName(tt.args.roleName, tt.args.pipelineId); got != tt.want {
+				t.Errorf("GenerateRoleSessionName() = %v, want %v", got, tt.want)
+			} else {
+				if len(got) > 64 {
+					t.Errorf("GenerateRoleSessionName() = %v is over 64 characters long (%d)", got, len(got))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package gitlabcreds
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ClockSkew the tolerance applied when checking the time claims of the token.
+const ClockSkew = 30 * time.Second
+
+// Token is a decoded JSON web token. The signature is not verified nor retained.
+type Token struct {
+	Header map[string]interface{}
+	Claims map[string]interface{}
+}
+
+func decodeTokenPart(part string) (map[string]interface{}, error) {
+	content, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(part, "="))
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var result map[string]interface{}
+	if err = decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ParseToken decodes the header and claims of the JSON web token, without verifying the signature.
+func ParseToken(token string) (*Token, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("the web identity token is not a JSON web token, expected three parts separated by a dot")
+	}
+	header, err := decodeTokenPart(parts[0])
+	if err != nil {
+		return nil, errors.Errorf("failed to decode the header of the web identity token, %s", err)
+	}
+	claims, err := decodeTokenPart(parts[1])
+	if err != nil {
+		return nil, errors.Errorf("failed to decode the claims of the web identity token, %s", err)
+	}
+	return &Token{Header: header, Claims: claims}, nil
+}
+
+// StringClaim returns the claim as string, or an empty string if it does not exist.
+func (t *Token) StringClaim(name string) string {
+	switch value := t.Claims[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+// TimeClaim returns the numeric date claim as time. found is false if the claim does not exist.
+func (t *Token) TimeClaim(name string) (result time.Time, found bool, err error) {
+	value, found := t.Claims[name]
+	if !found {
+		return result, false, nil
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return result, true, errors.Errorf("the %s claim of the web identity token is not a number", name)
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return result, true, errors.Errorf("the %s claim of the web identity token is not a number", name)
+	}
+	return time.Unix(int64(seconds), 0), true, nil
+}
+
+// Audiences returns the aud claim, which is either a single string or a list of strings.
+func (t *Token) Audiences() []string {
+	switch value := t.Claims["aud"].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		result := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// FormatDuration formats the duration rounded to seconds, without trailing zero units.
+func FormatDuration(d time.Duration) string {
+	result := d.Round(time.Second).String()
+	if strings.HasSuffix(result, "m0s") {
+		result = strings.TrimSuffix(result, "0s")
+	}
+	if strings.HasSuffix(result, "h0m") {
+		result = strings.TrimSuffix(result, "0m")
+	}
+	return result
+}
+
+// Validate checks the time claims of the token against now, and the audience and issuer against the expected
+// values if specified. It returns a precise error describing the first violation.
+func (t *Token) Validate(now time.Time, expectedAudience, expectedIssuer string) error {
+	if exp, found, err := t.TimeClaim("exp"); err != nil {
+		return err
+	} else if !found {
+		return errors.New("the web identity token has no exp claim")
+	} else if now.After(exp.Add(ClockSkew)) {
+		return errors.Errorf("the web identity token expired %s ago", FormatDuration(now.Sub(exp)))
+	}
+
+	if nbf, found, err := t.TimeClaim("nbf"); err != nil {
+		return err
+	} else if found && now.Add(ClockSkew).Before(nbf) {
+		return errors.Errorf("the web identity token is not valid before %s, which is %s from now", nbf.UTC().Format(time.RFC3339), FormatDuration(nbf.Sub(now)))
+	}
+
+	if iat, found, err := t.TimeClaim("iat"); err != nil {
+		return err
+	} else if found && now.Add(ClockSkew).Before(iat) {
+		return errors.Errorf("the web identity token is issued at %s, which is %s in the future. Check the clock of the runner", iat.UTC().Format(time.RFC3339), FormatDuration(iat.Sub(now)))
+	}
+
+	if expectedAudience != "" {
+		audiences := t.Audiences()
+		found := false
+		for _, audience := range audiences {
+			found = found || audience == expectedAudience
+		}
+		if !found {
+			return errors.Errorf("the audience of the web identity token is %s but the OIDC provider expects %s", strings.Join(audiences, ", "), expectedAudience)
+		}
+	}
+
+	if issuer := t.StringClaim("iss"); expectedIssuer != "" && strings.TrimSuffix(issuer, "/") != strings.TrimSuffix(expectedIssuer, "/") {
+		return errors.Errorf("the issuer of the web identity token is %s but %s was expected", issuer, expectedIssuer)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package gitlabcreds
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newToken(t *testing.T, claims map[string]interface{}) string {
+	encode := func(value interface{}) string {
+		content, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(content)
+	}
+	return encode(map[string]interface{}{"alg": "RS256", "typ": "JWT"}) + "." + encode(claims) + ".c2lnbmF0dXJl"
+}
+
+func TestParseToken(t *testing.T) {
+	token, err := ParseToken(newToken(t, map[string]interface{}{"sub": "project_path:binxio/demo:ref_type:branch:ref:main", "aud": []string{"a", "b"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["alg"] != "RS256" {
+		t.Errorf("expected alg RS256, got %v", token.Header["alg"])
+	}
+	if sub := token.StringClaim("sub"); sub != "project_path:binxio/demo:ref_type:branch:ref:main" {
+		t.Errorf("unexpected sub %s", sub)
+	}
+	if aud := token.Audiences(); len(aud) != 2 || aud[1] != "b" {
+		t.Errorf("unexpected audiences %v", aud)
+	}
+
+	for _, invalid := range []string{"", "a.b", "!!!.e30.c2ln", "e30.!!!.c2ln"} {
+		if _, err = ParseToken(invalid); err == nil {
+			t.Errorf("expected an error parsing '%s'", invalid)
+		}
+	}
+}
+
+func TestTokenValidate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	valid := map[string]interface{}{
+		"iss": "https://gitlab.example.com",
+		"aud": "sts.amazonaws.com",
+		"iat": now.Add(-time.Minute).Unix(),
+		"nbf": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	with := func(name string, value interface{}) map[string]interface{} {
+		result := map[string]interface{}{}
+		for k, v := range valid {
+			result[k] = v
+		}
+		if value == nil {
+			delete(result, name)
+		} else {
+			result[name] = value
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		claims   map[string]interface{}
+		audience string
+		issuer   string
+		wantErr  string
+	}{
+		{"valid", valid, "sts.amazonaws.com", "https://gitlab.example.com/", ""},
+		{"no expectations", with("aud", "https://gitlab.example.com"), "", "", ""},
+		{"expired", with("exp", now.Add(-4*time.Minute).Unix()), "", "", "expired 4m ago"},
+		{"expired within clock skew", with("exp", now.Add(-10*time.Second).Unix()), "", "", ""},
+		{"no exp", with("exp", nil), "", "", "no exp claim"},
+		{"not yet valid", with("nbf", now.Add(time.Hour).Unix()), "", "", "which is 1h from now"},
+		{"issued in the future", with("iat", now.Add(2*time.Minute).Unix()), "", "", "2m in the future"},
+		{"wrong audience", with("aud", "https://gitlab.example.com"), "sts.amazonaws.com", "", "audience of the web identity token is https://gitlab.example.com but the OIDC provider expects sts.amazonaws.com"},
+		{"one of the audiences", with("aud", []string{"https://gitlab.example.com", "sts.amazonaws.com"}), "sts.amazonaws.com", "", ""},
+		{"wrong issuer", valid, "", "https://gitlab.com", "issuer of the web identity token is https://gitlab.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := ParseToken(newToken(t, tt.claims))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = token.Validate(now, tt.audience, tt.issuer)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Validate() unexpected error %s", err)
+			} else if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package gitlabcreds
+
+import (
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DeprecatedTokenName the predefined Gitlab variable with the id token, used when no id token is found.
+const DeprecatedTokenName = "CI_JOB_JWT_V2"
+
+// TokenSource supplies the web identity token.
+type TokenSource interface {
+	// Token returns the current web identity token.
+	Token() (string, error)
+}
+
+// EnvTokenSource reads the token from an environment variable.
+type EnvTokenSource struct {
+	Name string
+}
+
+// Token returns the value of the environment variable.
+func (s *EnvTokenSource) Token() (string, error) {
+	if token := os.Getenv(s.Name); token != "" {
+		return token, nil
+	}
+	return "", errors.Errorf("the environment variable %s is not set", s.Name)
+}
+
+// FileTokenSource reads the token from a file, on every call.
+type FileTokenSource struct {
+	Path string
+}
+
+// Token returns the content of the file.
+func (s *FileTokenSource) Token() (string, error) {
+	content, err := os.ReadFile(s.Path)
+	if err != nil {
+		return "", errors.Errorf("failed to read the web identity token from %s, %s", s.Path, err)
+	}
+	if token := strings.TrimSpace(string(content)); token != "" {
+		return token, nil
+	}
+	return "", errors.Errorf("the web identity token file %s is empty", s.Path)
+}
+
+// ReaderTokenSource reads the token once from a reader, like stdin.
+type ReaderTokenSource struct {
+	Reader io.Reader
+	once   sync.Once
+	token  string
+	err    error
+}
+
+// Token returns the content read from the reader.
+func (s *ReaderTokenSource) Token() (string, error) {
+	s.once.Do(func() {
+		var content []byte
+		if content, s.err = io.ReadAll(s.Reader); s.err != nil {
+			s.err = errors.Errorf("failed to read the web identity token from stdin, %s", s.err)
+		} else if s.token = strings.TrimSpace(string(content)); s.token == "" {
+			s.err = errors.New("no web identity token was read from stdin")
+		}
+	})
+	return s.token, s.err
+}
+
+// FallbackTokenSource returns the token of the primary source, or of the deprecated source if the
+// primary source fails.
+type FallbackTokenSource struct {
+	Primary    TokenSource
+	Deprecated TokenSource
+	warnOnce   sync.Once
+}
+
+// Token returns the token of the primary source, or the deprecated source.
+func (s *FallbackTokenSource) Token() (string, error) {
+	token, err := s.Primary.Token()
+	if err == nil {
+		return token, nil
+	}
+	if deprecated, deprecatedErr := s.Deprecated.Token(); deprecatedErr == nil {
+		s.warnOnce.Do(func() {
+			log.Printf("WARNING: %s, using the deprecated %s instead. Please configure an id token", err, DeprecatedTokenName)
+		})
+		return deprecated, nil
+	}
+	return "", err
+}
+
+// NewEnvTokenSourceWithFallback returns a token source reading the environment variable, falling back
+// to the deprecated CI_JOB_JWT_V2.
+func NewEnvTokenSourceWithFallback(name string) TokenSource {
+	return &FallbackTokenSource{
+		Primary:    &EnvTokenSource{Name: name},
+		Deprecated: &EnvTokenSource{Name: DeprecatedTokenName},
+	}
+}
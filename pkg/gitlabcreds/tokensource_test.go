@@ -0,0 +1,18 @@
+package gitlabcreds
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReaderTokenSource(t *testing.T) {
+	source := &ReaderTokenSource{Reader: strings.NewReader("stdin-token\n")}
+	for i := 0; i < 2; i++ {
+		if got, err := source.Token(); err != nil || got != "stdin-token" {
+			t.Errorf("expected stdin-token, got %s, %v", got, err)
+		}
+	}
+	if _, err := (&ReaderTokenSource{Reader: strings.NewReader("")}).Token(); err == nil {
+		t.Errorf("expected an error on empty input")
+	}
+}
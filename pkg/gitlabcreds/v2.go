@@ -0,0 +1,35 @@
+package gitlabcreds
+
+import (
+	"context"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// V2CredentialsProvider adapts the provider to the aws.CredentialsProvider interface of the aws-sdk-go-v2.
+// Wrap it in an aws.CredentialsCache, which refreshes the credentials before they expire:
+//
+//	cfg.Credentials = awsv2.NewCredentialsCache(gitlabcreds.V2CredentialsProvider{Provider: provider})
+type V2CredentialsProvider struct {
+	Provider *Provider
+}
+
+// Retrieve returns the credentials of the provider, with the expiration set.
+func (v V2CredentialsProvider) Retrieve(ctx context.Context) (awsv2.Credentials, error) {
+	if err := ctx.Err(); err != nil {
+		return awsv2.Credentials{}, err
+	}
+	result, err := v.Provider.GetCredentials()
+	if err != nil {
+		return awsv2.Credentials{}, err
+	}
+	return awsv2.Credentials{
+		AccessKeyID:     aws.StringValue(result.AccessKeyId),
+		SecretAccessKey: aws.StringValue(result.SecretAccessKey),
+		SessionToken:    aws.StringValue(result.SessionToken),
+		Source:          ProviderName,
+		CanExpire:       result.Expiration != nil,
+		Expires:         aws.TimeValue(result.Expiration),
+	}, nil
+}